@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type Network string
+
+const (
+	Mainnet Network = "mainnet"
+	Testnet Network = "testnet"
+	Signet  Network = "signet"
+	Regtest Network = "regtest"
+)
+
+type AddressType string
+
+const (
+	P2PKH          AddressType = "P2PKH"
+	P2SH           AddressType = "P2SH"
+	P2WPKH         AddressType = "P2WPKH"
+	P2WSH          AddressType = "P2WSH"
+	P2TR           AddressType = "P2TR"
+	WitnessUnknown AddressType = "Witness (unknown version)"
+)
+
+// Decoded form of a bitcoin address
+type AddressInfo struct {
+	Address  string
+	Type     AddressType
+	Networks []Network // networks the address encoding is valid on
+	Program  []byte    // hash160 / witness program
+}
+
+func (a *AddressInfo) ValidOn(network Network) bool {
+	for _, n := range a.Networks {
+		if n == network {
+			return true
+		}
+	}
+	return false
+}
+
+// Base58 version bytes per network
+var base58Versions = map[byte]struct {
+	addrType AddressType
+	networks []Network
+}{
+	0x00: {P2PKH, []Network{Mainnet}},
+	0x05: {P2SH, []Network{Mainnet}},
+	0x6f: {P2PKH, []Network{Testnet, Signet, Regtest}},
+	0xc4: {P2SH, []Network{Testnet, Signet, Regtest}},
+}
+
+// Bech32 human readable parts per network
+var bech32HRPs = map[string][]Network{
+	"bc":   {Mainnet},
+	"tb":   {Testnet, Signet},
+	"bcrt": {Regtest},
+}
+
+// Checks an address is well formed and belongs to the given network
+func validateAddress(address string, network Network) (*AddressInfo, error) {
+	info, err := decodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if !info.ValidOn(network) {
+		var names []string
+		for _, n := range info.Networks {
+			names = append(names, string(n))
+		}
+		return nil, fmt.Errorf("address %s is a %s address, not valid on %s", address, strings.Join(names, "/"), network)
+	}
+	return info, nil
+}
+
+func decodeAddress(address string) (*AddressInfo, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+
+	// Anything with a known bech32 prefix is decoded as segwit so the
+	// error describes the bech32 problem instead of a base58 one
+	lower := strings.ToLower(address)
+	for hrp := range bech32HRPs {
+		if strings.HasPrefix(lower, hrp+"1") {
+			return decodeSegwitAddress(address)
+		}
+	}
+	return decodeBase58Address(address)
+}
+
+// Address type for a script, or empty when the address can't be decoded.
+// Used by the reports which shouldn't fail on odd counterparties
+func addressType(address string) AddressType {
+	info, err := decodeAddress(address)
+	if err != nil {
+		return ""
+	}
+	return info.Type
+}
+
+//Base58Check
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for i, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", c, i)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	decoded := n.Bytes()
+	// Leading '1's are leading zero bytes
+	var zeros int
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
+
+func decodeBase58Address(address string) (*AddressInfo, error) {
+	raw, err := base58Decode(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 25 {
+		return nil, fmt.Errorf("invalid base58 address length: %d bytes, expected 25", len(raw))
+	}
+
+	payload, checksum := raw[:21], raw[21:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return nil, fmt.Errorf("base58 checksum mismatch (typo in address?)")
+	}
+
+	version, ok := base58Versions[payload[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown base58 version byte 0x%02x", payload[0])
+	}
+
+	return &AddressInfo{
+		Address:  address,
+		Type:     version.addrType,
+		Networks: version.networks,
+		Program:  payload[1:],
+	}, nil
+}
+
+//Bech32 / Bech32m (BIP173, BIP350)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// Returns hrp, data (without checksum) and the checksum constant used
+func bech32Decode(s string) (string, []byte, uint32, error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("bech32 address too long: %d characters", len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("bech32 address mixes upper and lower case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndex(s, "1")
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("invalid bech32 separator position")
+	}
+
+	hrp := s[:sep]
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		idx := strings.IndexByte(bech32Charset, s[i])
+		if idx < 0 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 character %q at position %d", s[i], i)
+		}
+		data = append(data, byte(idx))
+	}
+
+	constant := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != bech32Const && constant != bech32mConst {
+		return "", nil, 0, fmt.Errorf("bech32 checksum mismatch (typo in address?)")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// Regroups 5 bit words into bytes
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	maxv := uint(1)<<to - 1
+	var out []byte
+	for _, v := range data {
+		acc = acc<<from | uint(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, fmt.Errorf("invalid padding in witness program")
+	}
+	return out, nil
+}
+
+func decodeSegwitAddress(address string) (*AddressInfo, error) {
+	hrp, data, constant, err := bech32Decode(address)
+	if err != nil {
+		return nil, err
+	}
+
+	networks, ok := bech32HRPs[hrp]
+	if !ok {
+		return nil, fmt.Errorf("unknown bech32 prefix %q", hrp)
+	}
+	if len(data) < 1 {
+		return nil, fmt.Errorf("missing witness version")
+	}
+
+	version := data[0]
+	if version > 16 {
+		return nil, fmt.Errorf("invalid witness version %d", version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return nil, fmt.Errorf("invalid witness program length: %d bytes", len(program))
+	}
+
+	if version == 0 && constant != bech32Const {
+		return nil, fmt.Errorf("witness v0 address must use bech32, not bech32m")
+	}
+	if version != 0 && constant != bech32mConst {
+		return nil, fmt.Errorf("witness v%d address must use bech32m, not bech32", version)
+	}
+
+	var addrType AddressType
+	switch {
+	case version == 0 && len(program) == 20:
+		addrType = P2WPKH
+	case version == 0 && len(program) == 32:
+		addrType = P2WSH
+	case version == 0:
+		return nil, fmt.Errorf("invalid witness v0 program length: %d bytes, expected 20 or 32", len(program))
+	case version == 1 && len(program) == 32:
+		addrType = P2TR
+	default:
+		addrType = WitnessUnknown
+	}
+
+	return &AddressInfo{
+		Address:  address,
+		Type:     addrType,
+		Networks: networks,
+		Program:  program,
+	}, nil
+}
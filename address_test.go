@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Valid segwit addresses from BIP173 and BIP350 with a prefix we know.
+// program is the witness program without the version and length bytes
+func TestDecodeSegwitValid(t *testing.T) {
+	tests := []struct {
+		address  string
+		addrType AddressType
+		network  Network
+		program  string
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", P2WPKH, Mainnet, "751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", P2WSH, Testnet, "1863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262"},
+		{"bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", WitnessUnknown, Mainnet, "751e76e8199196d454941c45d1b3a323f1433bd6751e76e8199196d454941c45d1b3a323f1433bd6"},
+		{"BC1SW50QGDZ25J", WitnessUnknown, Mainnet, "751e"},
+		{"bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", WitnessUnknown, Mainnet, "751e76e8199196d454941c45d1b3a323"},
+		{"tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", P2WSH, Testnet, "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", P2TR, Signet, "000000c4a5cad46221b2a187905e5266362b99d5e91c6ce24d165dab93e86433"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", P2TR, Mainnet, "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", P2WPKH, Regtest, "751e76e8199196d454941c45d1b3a323f1433bd6"},
+	}
+	for _, tt := range tests {
+		info, err := validateAddress(tt.address, tt.network)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.address, err)
+			continue
+		}
+		if info.Type != tt.addrType {
+			t.Errorf("%s: type %s, want %s", tt.address, info.Type, tt.addrType)
+		}
+		if got := hex.EncodeToString(info.Program); got != tt.program {
+			t.Errorf("%s: program %s, want %s", tt.address, got, tt.program)
+		}
+	}
+}
+
+// Invalid addresses from BIP173 and BIP350
+func TestDecodeSegwitInvalid(t *testing.T) {
+	tests := []struct {
+		address string
+		reason  string
+	}{
+		{"tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut", "invalid human-readable part"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", "bech32 checksum for v1"},
+		{"tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf", "bech32 checksum for v2"},
+		{"BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", "bech32 checksum for v16"},
+		{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", "bech32m checksum for v0"},
+		{"tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47", "bech32m checksum for v0"},
+		{"bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", "invalid character"},
+		{"BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R", "invalid witness version"},
+		{"bc1pw5dgrnzv", "program too short"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav", "program too long"},
+		{"BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", "invalid v0 program length"},
+		{"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq", "mixed case"},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf", "more than 4 padding bits"},
+		{"tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j", "non-zero padding"},
+		{"bc1gmk9yu", "empty data section"},
+	}
+	for _, tt := range tests {
+		if info, err := decodeAddress(tt.address); err == nil {
+			t.Errorf("%s (%s): decoded as %s, want an error", tt.address, tt.reason, info.Type)
+		}
+	}
+}
+
+func TestDecodeBase58(t *testing.T) {
+	tests := []struct {
+		address  string
+		addrType AddressType
+		network  Network
+	}{
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", P2PKH, Mainnet},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", P2SH, Mainnet},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", P2PKH, Testnet},
+		{"2MzQwSSnBHWHqSAqtTVQ6v47XtaisrJa1Vc", P2SH, Regtest},
+	}
+	for _, tt := range tests {
+		info, err := validateAddress(tt.address, tt.network)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.address, err)
+			continue
+		}
+		if info.Type != tt.addrType || len(info.Program) != 20 {
+			t.Errorf("%s: got %s with a %d byte hash, want %s with 20", tt.address, info.Type, len(info.Program), tt.addrType)
+		}
+	}
+}
+
+func TestDecodeBase58Invalid(t *testing.T) {
+	tests := []struct {
+		address string
+		err     string
+	}{
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", "checksum mismatch"},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLz", "checksum mismatch"},
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN0", "invalid base58 character"},
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVNI", "invalid base58 character"},
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJa", "length"},
+		{"1111111111", "length"},
+	}
+	for _, tt := range tests {
+		_, err := decodeAddress(tt.address)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %v, want one mentioning %q", tt.address, err, tt.err)
+		}
+	}
+}
+
+func TestValidateAddressNetwork(t *testing.T) {
+	tests := []struct {
+		address string
+		network Network
+	}{
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", Regtest},
+		{"bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", Mainnet},
+		{"tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Mainnet},
+		{"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Testnet},
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", Mainnet},
+	}
+	for _, tt := range tests {
+		if _, err := validateAddress(tt.address, tt.network); err == nil {
+			t.Errorf("%s: accepted on %s", tt.address, tt.network)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package analysis holds the transaction types and the Analyzer interface
+// shared by the built-in reports and analyzers living in other packages.
+//
+// An analyzer package registers itself from init and is linked in with a
+// blank import in plugins.go:
+//
+//	func init() {
+//		analysis.Register(myAnalyzer{})
+//	}
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Low
+	Medium
+	High
+	Critical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+func (s Severity) String() string {
+	if s < Info || s > Critical {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for i, known := range severityNames {
+		if strings.EqualFold(name, known) {
+			return Severity(i), nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q", name)
+}
+
+// One thing an analyzer noticed, with the txs and addresses behind it
+type Finding struct {
+	Analyzer  string // set by Run
+	ID        string // stable identifier, e.g. "patterns.burst"
+	Severity  Severity
+	Message   string
+	TxIDs     []string
+	Addresses []string
+}
+
+// Lookups analyzers may use to go beyond the wallet's own history
+type Fetcher interface {
+	FetchTransaction(ref string) (*Transaction, error)
+	FetchOutspend(ref string, n int) (*Transaction, error)
+}
+
+// What every analyzer gets to work with
+type Context struct {
+	Address      string
+	Transactions []Transaction
+	Details      map[string]TransactionDetails
+	Fetcher      Fetcher
+	// Whatever the calling program keeps for its own built-in analyzers,
+	// analyzers in other packages can ignore it
+	State interface{}
+}
+
+type Analyzer interface {
+	Name() string
+	// Analyze may print its own report, findings are collected by the caller
+	Analyze(ctx *Context) ([]Finding, error)
+}
+
+// Analyzers implementing OptIn only run when named explicitly
+type OptIn interface {
+	OptIn() bool
+}
+
+var (
+	mu        sync.Mutex
+	analyzers = make(map[string]Analyzer)
+)
+
+// Register makes an analyzer available by name. It panics on an empty or
+// duplicate name, like database/sql.Register
+func Register(a Analyzer) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := a.Name()
+	if name == "" {
+		panic("analysis: Register with empty name")
+	}
+	if _, dup := analyzers[name]; dup {
+		panic("analysis: Register called twice for " + name)
+	}
+	analyzers[name] = a
+}
+
+func Get(name string) (Analyzer, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	a, ok := analyzers[name]
+	return a, ok
+}
+
+// Names of every registered analyzer, sorted
+func Names() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	var names []string
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run calls one analyzer and stamps its name on the findings
+func Run(a Analyzer, ctx *Context) ([]Finding, error) {
+	findings, err := a.Analyze(ctx)
+	for i := range findings {
+		findings[i].Analyzer = a.Name()
+	}
+	return findings, err
+}
+
+func IsOptIn(a Analyzer) bool {
+	optIn, ok := a.(OptIn)
+	return ok && optIn.OptIn()
+}
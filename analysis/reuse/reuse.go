@@ -0,0 +1,72 @@
+// Package reuse flags address reuse: the watched address receiving many
+// payments, and counterparties that were paid more than once. It is also
+// the example of an analyzer living outside main.
+package reuse
+
+import (
+	"fmt"
+	"sort"
+
+	"crypto_tracker/analysis"
+)
+
+const MIN_REUSE = 3
+
+type reuseAnalyzer struct{}
+
+func init() {
+	analysis.Register(reuseAnalyzer{})
+}
+
+func (reuseAnalyzer) Name() string { return "reuse" }
+
+func (reuseAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	var findings []analysis.Finding
+
+	var received []string
+	paid := make(map[string][]string)
+	for _, tx := range ctx.Transactions {
+		sent := false
+		for _, in := range tx.Inputs {
+			if in.PrevOut.Addr == ctx.Address {
+				sent = true
+				break
+			}
+		}
+		for _, out := range tx.Out {
+			switch {
+			case out.Addr == ctx.Address && !sent:
+				received = append(received, tx.TxID)
+			case sent && out.Addr != "" && out.Addr != ctx.Address:
+				paid[out.Addr] = append(paid[out.Addr], tx.TxID)
+			}
+		}
+	}
+
+	if len(received) >= MIN_REUSE {
+		findings = append(findings, analysis.Finding{
+			ID:       "reuse.receive",
+			Severity: analysis.Low,
+			Message:  fmt.Sprintf("Address received %d payments, reuse links all of them together", len(received)),
+			TxIDs:    received,
+		})
+	}
+
+	var addrs []string
+	for addr, txids := range paid {
+		if len(txids) >= MIN_REUSE {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		findings = append(findings, analysis.Finding{
+			ID:        "reuse.payee",
+			Severity:  analysis.Info,
+			Message:   fmt.Sprintf("Paid the same address %d times", len(paid[addr])),
+			TxIDs:     paid[addr],
+			Addresses: []string{addr},
+		})
+	}
+	return findings, nil
+}
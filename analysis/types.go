@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"fmt"
+	"time"
+)
+
+type Input struct {
+	PrevOut struct {
+		Addr    string `json:"addr"`
+		Value   int64  `json:"value"`
+		TxIndex int64  `json:"tx_index"`
+		TxID    string `json:"txid"`
+		N       int    `json:"n"`
+	} `json:"prev_out"`
+	Sequence uint32 `json:"sequence"`
+}
+
+type Output struct {
+	Addr  string `json:"addr"`
+	Value int64  `json:"value"`
+	Spent bool   `json:"spent"`
+	N     int    `json:"n"`
+}
+
+type Transaction struct {
+	TxID          string   `json:"hash"`
+	TxIndex       int64    `json:"tx_index"`
+	BlockHeight   int      `json:"block_height"`
+	Confirmations int      `json:"confirmations"`
+	Time          int      `json:"time"`
+	Fee           int64    `json:"fee"`
+	Size          int      `json:"size"`
+	Weight        int      `json:"weight"`
+	VinSz         int      `json:"vin_sz"`
+	VoutSz        int      `json:"vout_sz"`
+	Inputs        []Input  `json:"inputs"`
+	Out           []Output `json:"out"`
+}
+
+// Txs are referenced by tx_index on blockchain.info and by txid on Esplora
+func (in Input) PrevRef() string {
+	if in.PrevOut.TxID != "" {
+		return in.PrevOut.TxID
+	}
+	return fmt.Sprintf("%d", in.PrevOut.TxIndex)
+}
+
+func (in Input) Outpoint() string {
+	return fmt.Sprintf("%s:%d", in.PrevRef(), in.PrevOut.N)
+}
+
+func (tx Transaction) Ref() string {
+	if tx.TxIndex == 0 {
+		return tx.TxID
+	}
+	return fmt.Sprintf("%d", tx.TxIndex)
+}
+
+func (tx Transaction) Outpoint(n int) string {
+	return fmt.Sprintf("%s:%d", tx.Ref(), n)
+}
+
+func (tx Transaction) Pending() bool {
+	return tx.BlockHeight == 0
+}
+
+// Virtual size in vbytes, falls back to the raw size for legacy-only data
+func (tx Transaction) VSize() int {
+	if tx.Weight > 0 {
+		return (tx.Weight + 3) / 4
+	}
+	return tx.Size
+}
+
+func (tx Transaction) FeeRate() float64 {
+	if tx.VSize() == 0 {
+		return 0
+	}
+	return float64(tx.Fee) / float64(tx.VSize())
+}
+
+// BIP125 opt-in replace-by-fee
+func (tx Transaction) SignalsRBF() bool {
+	for _, in := range tx.Inputs {
+		if in.Sequence < 0xfffffffe {
+			return true
+		}
+	}
+	return false
+}
+
+// Per-tx values worked out for the watched wallet while building the table
+type TransactionDetails struct {
+	Amount        float64
+	Price         float64
+	Time          time.Time
+	Confirmations int
+	Pending       bool
+	RBF           bool
+	PaymentAmount float64 // outgoing only, excludes detected change and fee
+	Flags         []string
+	DisplayOrigin string
+	DisplayDest   string
+}
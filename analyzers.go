@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"crypto_tracker/analysis"
+)
+
+// Built-in reports in the order they run. Analyzers from other packages
+// run after them, sorted by name
+var builtinAnalyzers = []string{"mempool", "patterns", "anomaly", "behavior", "dust", "privacy", "flows", "change", "fees", "utxo", "peel"}
+
+// What the built-in analyzers need beyond analysis.Context, passed in
+// ctx.State by main and the TUI
+type runState struct {
+	db        *sql.DB
+	clusters  *Clusters
+	screening []ScreeningMatch
+	price     float64
+	feeRate   float64
+	peelDepth int
+	readOnly  bool            // report only, nothing is stored in db
+	metrics   Metrics         // reported by the analyzers for the risk rules
+	risk      *RiskAssessment // scored once every analyzer ran
+}
+
+func (s *runState) addMetrics(metrics Metrics) {
+	if s.metrics == nil {
+		s.metrics = make(Metrics)
+	}
+	for name, value := range metrics {
+		s.metrics[name] = value
+	}
+}
+
+// State of the run ctx belongs to. Callers from other packages don't set
+// one, they get clusters of the history and the flag defaults, without a
+// db nothing is stored
+func stateOf(ctx *analysis.Context) *runState {
+	if state, ok := ctx.State.(*runState); ok {
+		return state
+	}
+	return &runState{clusters: buildClusters(ctx.Transactions), feeRate: 10, peelDepth: 10, readOnly: true}
+}
+
+type mempoolAnalyzer struct{}
+
+func (mempoolAnalyzer) Name() string { return "mempool" }
+
+func (mempoolAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	state := stateOf(ctx)
+	if state.db == nil {
+		return nil, fmt.Errorf("mempool tracking needs the database of a regular run")
+	}
+	events, err := trackMempool(state.db, ctx.Fetcher, ctx.Address, ctx.Transactions, state.readOnly)
+	if err != nil {
+		log.Printf("Error tracking mempool transactions: %v", err)
+	}
+	printMempoolReport(ctx.Address, ctx.Transactions, events)
+	state.addMetrics(mempoolMetrics(ctx.Transactions, events))
+	return mempoolFindings(events), err
+}
+
+type patternsAnalyzer struct{}
+
+func (patternsAnalyzer) Name() string { return "patterns" }
+
+func (patternsAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	findings, metrics := analyzeTransactionPatterns(ctx.Transactions, ctx.Address, ctx.Details)
+	stateOf(ctx).addMetrics(metrics)
+	return findings, nil
+}
+
+type anomalyAnalyzer struct{}
+
+func (anomalyAnalyzer) Name() string { return "anomaly" }
+
+func (anomalyAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	findings, metrics := analyzeAnomalies(ctx.Transactions, ctx.Details)
+	stateOf(ctx).addMetrics(metrics)
+	return findings, nil
+}
+
+type behaviorAnalyzer struct{}
+
+func (behaviorAnalyzer) Name() string { return "behavior" }
+
+func (behaviorAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	state := stateOf(ctx)
+	findings, metrics := analyzeWalletBehavior(ctx.Transactions, ctx.Address, ctx.Details, state.clusters, state.screening)
+	state.addMetrics(metrics)
+	return findings, nil
+}
+
+type dustAnalyzer struct{}
+
+func (dustAnalyzer) Name() string { return "dust" }
+
+func (dustAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	findings, metrics := analyzeDust(ctx.Transactions, ctx.Address)
+	stateOf(ctx).addMetrics(metrics)
+	return findings, nil
+}
+
+type privacyAnalyzer struct{}
+
+func (privacyAnalyzer) Name() string { return "privacy" }
+
+func (privacyAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	state := stateOf(ctx)
+	findings, metrics := analyzePrivacy(ctx.Transactions, ctx.Address, state.clusters)
+	state.addMetrics(metrics)
+	return findings, nil
+}
+
+type flowsAnalyzer struct{}
+
+func (flowsAnalyzer) Name() string { return "flows" }
+
+func (flowsAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	findings, metrics := analyzeFlows(ctx.Transactions, ctx.Address, ctx.Details)
+	stateOf(ctx).addMetrics(metrics)
+	return findings, nil
+}
+
+type changeAnalyzer struct{}
+
+func (changeAnalyzer) Name() string { return "change" }
+
+func (changeAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	printChangeAnalysis(ctx.Transactions, ctx.Address)
+	return nil, nil
+}
+
+type feesAnalyzer struct{}
+
+func (feesAnalyzer) Name() string { return "fees" }
+
+func (feesAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	stateOf(ctx).addMetrics(analyzeFees(ctx.Transactions, ctx.Address, ctx.Details))
+	return nil, nil
+}
+
+type utxoAnalyzer struct{}
+
+func (utxoAnalyzer) Name() string { return "utxo" }
+
+func (utxoAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	state := stateOf(ctx)
+	state.addMetrics(analyzeUTXOs(ctx.Transactions, ctx.Address, state.price, state.feeRate))
+	return nil, nil
+}
+
+// Fetches a lot, so it only runs with -peel-wallet or when named
+type peelAnalyzer struct{}
+
+func (peelAnalyzer) Name() string { return "peel" }
+
+func (peelAnalyzer) OptIn() bool { return true }
+
+func (peelAnalyzer) Analyze(ctx *analysis.Context) ([]analysis.Finding, error) {
+	if ctx.Fetcher == nil {
+		return nil, fmt.Errorf("peel chain tracing needs a Fetcher")
+	}
+	state := stateOf(ctx)
+	findings, metrics := analyzePeelChains(ctx.Fetcher, ctx.Transactions, ctx.Address, state.peelDepth)
+	state.addMetrics(metrics)
+	return findings, nil
+}
+
+func init() {
+	analysis.Register(mempoolAnalyzer{})
+	analysis.Register(patternsAnalyzer{})
+	analysis.Register(anomalyAnalyzer{})
+	analysis.Register(behaviorAnalyzer{})
+	analysis.Register(dustAnalyzer{})
+	analysis.Register(privacyAnalyzer{})
+	analysis.Register(flowsAnalyzer{})
+	analysis.Register(changeAnalyzer{})
+	analysis.Register(feesAnalyzer{})
+	analysis.Register(utxoAnalyzer{})
+	analysis.Register(peelAnalyzer{})
+}
+
+// Runs the analyzers, then scores the metrics they reported against the
+// risk rules. Without a runState there is nothing to score
+func runAnalyzers(analyzers []analysis.Analyzer, ctx *analysis.Context) []analysis.Finding {
+	var findings []analysis.Finding
+	for _, a := range analyzers {
+		found, err := analysis.Run(a, ctx)
+		if err != nil {
+			log.Printf("Error in analyzer %s: %v", a.Name(), err)
+		}
+		findings = append(findings, found...)
+	}
+	if state, ok := ctx.State.(*runState); ok {
+		// Screening runs before the analyzers, whichever are selected
+		state.addMetrics(Metrics{"blocklist_matches": float64(len(state.screening))})
+		findings = append(findings, assessRisk(state)...)
+	}
+	return findings
+}
+
+// Built-ins first, then everything registered by other packages
+func analyzerNames() []string {
+	names := append([]string{}, builtinAnalyzers...)
+	builtin := make(map[string]bool)
+	for _, name := range builtinAnalyzers {
+		builtin[name] = true
+	}
+	for _, name := range analysis.Names() {
+		if !builtin[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Parses the -analyzers list. "default" selects every analyzer that
+// isn't opt-in, "all" selects every analyzer
+func parseAnalyzers(list string) ([]analysis.Analyzer, error) {
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case "all", "default":
+			for _, n := range analyzerNames() {
+				a, _ := analysis.Get(n)
+				if name == "all" || !analysis.IsOptIn(a) {
+					enabled[n] = true
+				}
+			}
+		default:
+			if _, ok := analysis.Get(name); !ok {
+				return nil, fmt.Errorf("unknown analyzer %q (available: %s)", name, strings.Join(analyzerNames(), ", "))
+			}
+			enabled[name] = true
+		}
+	}
+
+	var selected []analysis.Analyzer
+	for _, name := range analyzerNames() {
+		if enabled[name] {
+			a, _ := analysis.Get(name)
+			selected = append(selected, a)
+		}
+	}
+	return selected, nil
+}
+
+func printFindings(findings []analysis.Finding) {
+	fmt.Printf("\n%s=== Findings ===%s\n\n", Yellow, Reset)
+	if len(findings) == 0 {
+		fmt.Printf("- No findings\n")
+		return
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	for _, f := range findings {
+		color := Reset
+		switch {
+		case f.Severity >= analysis.High:
+			color = Red
+		case f.Severity == analysis.Medium:
+			color = Yellow
+		}
+		fmt.Printf("%s[%s]%s %s (%s)\n", color, f.Severity, Reset, f.Message, f.ID)
+		if len(f.Addresses) > 0 {
+			fmt.Printf("  - Addresses: %s\n", formatAddresses(f.Addresses, 3))
+		}
+		if len(f.TxIDs) > 0 {
+			fmt.Printf("  - Transactions: %s\n", formatList(f.TxIDs, 3))
+		}
+	}
+}
+
+func formatList(items []string, limit int) string {
+	if len(items) <= limit {
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("%s (+%d)", strings.Join(items[:limit], ", "), len(items)-limit)
+}
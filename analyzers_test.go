@@ -0,0 +1,123 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"crypto_tracker/analysis"
+)
+
+// Backend stand-in: txs by ref, spenders by "ref:n". Counts requests
+type testFetcher struct {
+	txs       map[string]Transaction
+	outspends map[string]Transaction
+	requests  int
+}
+
+func (f *testFetcher) FetchTransaction(ref string) (*Transaction, error) {
+	f.requests++
+	tx, ok := f.txs[ref]
+	if !ok {
+		return nil, fmt.Errorf("no transaction %s", ref)
+	}
+	return &tx, nil
+}
+
+func (f *testFetcher) FetchOutspend(ref string, n int) (*Transaction, error) {
+	f.requests++
+	tx, ok := f.outspends[fmt.Sprintf("%s:%d", ref, n)]
+	if !ok {
+		return nil, nil
+	}
+	return &tx, nil
+}
+
+func testDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Analyzers from other packages call the built-ins without a runState
+func TestAnalyzersBareContext(t *testing.T) {
+	transactions := []Transaction{
+		testTx("in", 1_700_000_000, []testIO{{testLegacy, 50_001_000}}, []testIO{{testWatched, 50_000_000}}),
+		testTx("out", 1_700_086_400, []testIO{{testWatched, 50_000_000}}, []testIO{{testSegwit, 2_000_000}, {testWatched, 47_999_000}}),
+		testTx("dust", 1_700_172_800, []testIO{{testScript, 100_000}}, []testIO{{testWatched, 546}, {testScript, 98_454}}),
+	}
+	transactions[2].BlockHeight = 0
+
+	restore := silenceOutput()
+	defer restore()
+	for _, name := range analysis.Names() {
+		a, _ := analysis.Get(name)
+		ctx := &analysis.Context{Address: testWatched, Transactions: transactions}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s panicked: %v", name, r)
+				}
+			}()
+			analysis.Run(a, ctx)
+		}()
+	}
+}
+
+func TestParseAnalyzers(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+		err  bool
+	}{
+		{list: "default", want: analyzerNamesWithout("peel")},
+		{list: "all", want: analyzerNames()},
+		{list: "patterns, FEES", want: []string{"patterns", "fees"}},
+		{list: "fees,patterns,fees", want: []string{"patterns", "fees"}},
+		{list: "default,peel", want: analyzerNames()},
+		{list: "", want: nil},
+		{list: "patterns,nope", err: true},
+	}
+	for _, tt := range tests {
+		analyzers, err := parseAnalyzers(tt.list)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: no error for an unknown analyzer", tt.list)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.list, err)
+			continue
+		}
+		var names []string
+		for _, a := range analyzers {
+			names = append(names, a.Name())
+		}
+		if len(names) != len(tt.want) {
+			t.Errorf("%q: %v, want %v", tt.list, names, tt.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.want[i] {
+				t.Errorf("%q: %v, want %v", tt.list, names, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func analyzerNamesWithout(optIn string) []string {
+	var names []string
+	for _, name := range analyzerNames() {
+		if name != optIn {
+			names = append(names, name)
+		}
+	}
+	return names
+}
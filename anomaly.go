@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+const (
+	ROLLING_WINDOW    = 20  // previous txs forming the amount baseline
+	MIN_BASELINE      = 5   // fewer txs than this and there is no baseline
+	MAD_Z_THRESHOLD   = 3.5 // Iglewicz and Hoaglin's cut-off for modified z-scores
+	GAP_P_THRESHOLD   = 0.01
+	MIN_SEASONAL_TXS  = 20
+	MIN_SEGMENT_DAYS  = 7
+	CHANGEPOINT_SCORE = 4.0 // rank-sum z-score
+	MAX_CHANGEPOINTS  = 5
+)
+
+// Tx that stands out from the baseline it was measured against
+type Anomaly struct {
+	TxID     string
+	Time     time.Time
+	Value    float64
+	Score    float64
+	Baseline string
+}
+
+// Median absolute deviation, scaled so it estimates the standard
+// deviation. Falls back to the mean absolute deviation when more than
+// half the values are identical
+func robustSpread(values []float64, med float64) float64 {
+	deviations := make([]float64, len(values))
+	var meanDev float64
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+		meanDev += deviations[i]
+	}
+	if mad := median(deviations); mad > 0 {
+		return 1.4826 * mad
+	}
+	return 1.2533 * meanDev / float64(len(values))
+}
+
+func sortedByTime(transactions []Transaction) []Transaction {
+	sorted := make([]Transaction, len(transactions))
+	copy(sorted, transactions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time < sorted[j].Time
+	})
+	return sorted
+}
+
+// Modified z-score of each amount against the median/MAD of the
+// ROLLING_WINDOW txs before it
+func amountAnomalies(sorted []Transaction, txDetails map[string]TransactionDetails) []Anomaly {
+	var anomalies []Anomaly
+	var history []float64
+	for _, tx := range sorted {
+		value := walletVolume(txDetails[tx.TxID])
+		if len(history) >= MIN_BASELINE {
+			window := history
+			if len(window) > ROLLING_WINDOW {
+				window = window[len(window)-ROLLING_WINDOW:]
+			}
+			med := median(window)
+			if spread := robustSpread(window, med); spread > 0 {
+				z := (value - med) / spread
+				if math.Abs(z) > MAD_Z_THRESHOLD {
+					anomalies = append(anomalies, Anomaly{
+						TxID: tx.TxID, Time: time.Unix(int64(tx.Time), 0), Value: value, Score: z,
+						Baseline: fmt.Sprintf("median %.8f BTC, MAD %.8f BTC over the last %d txs", med, spread/1.4826, len(window)),
+					})
+				}
+			}
+		}
+		history = append(history, value)
+	}
+	return anomalies
+}
+
+// Gaps between txs modelled as exponential around the mean gap. Score is
+// -log10 of the probability of a gap that short (or that long). Txs with
+// the same timestamp, one block or a batched withdrawal, arrive together
+func interArrivalAnomalies(transactions []Transaction) []Anomaly {
+	var sorted []Transaction
+	for i, tx := range transactions {
+		if i == 0 || tx.Time != transactions[i-1].Time {
+			sorted = append(sorted, tx)
+		}
+	}
+	if len(sorted) < MIN_BASELINE+1 {
+		return nil
+	}
+	var total float64
+	for i := 1; i < len(sorted); i++ {
+		total += float64(sorted[i].Time - sorted[i-1].Time)
+	}
+	meanGap := total / float64(len(sorted)-1)
+	if meanGap <= 0 {
+		return nil
+	}
+
+	var anomalies []Anomaly
+	for i := 1; i < len(sorted); i++ {
+		gap := float64(sorted[i].Time - sorted[i-1].Time)
+		short := 1 - math.Exp(-gap/meanGap) // P(gap <= observed)
+		long := math.Exp(-gap / meanGap)    // P(gap >= observed)
+		kind, p := "short", short
+		if long < short {
+			kind, p = "long", long
+		}
+		if p >= GAP_P_THRESHOLD {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			TxID: sorted[i].TxID, Time: time.Unix(int64(sorted[i].Time), 0), Value: gap, Score: -math.Log10(math.Max(p, 1e-12)),
+			Baseline: fmt.Sprintf("unusually %s gap of %s, mean gap %s", kind,
+				time.Duration(gap)*time.Second, (time.Duration(meanGap) * time.Second).Round(time.Minute)),
+		})
+	}
+	return anomalies
+}
+
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+func hourOfWeekLabel(how int) string {
+	return fmt.Sprintf("%s %02d:00 UTC", time.Weekday(how / 24).String()[:3], how%24)
+}
+
+// Txs in hours of the week the rest of the history never uses. Counts
+// are smoothed over the neighbouring hours so regular habits that drift
+// by an hour don't trigger
+func seasonalAnomalies(sorted []Transaction) []Anomaly {
+	if len(sorted) < MIN_SEASONAL_TXS {
+		return nil
+	}
+	var counts [168]int
+	for _, tx := range sorted {
+		counts[hourOfWeek(time.Unix(int64(tx.Time), 0))]++
+	}
+	busiest := 0
+	for how, count := range counts {
+		if count > counts[busiest] {
+			busiest = how
+		}
+	}
+
+	var anomalies []Anomaly
+	others := float64(len(sorted) - 1)
+	for _, tx := range sorted {
+		txTime := time.Unix(int64(tx.Time), 0)
+		how := hourOfWeek(txTime)
+		nearby := counts[how] - 1 + counts[(how+167)%168] + counts[(how+1)%168]
+		if nearby > 0 {
+			continue
+		}
+		// Laplace-smoothed share of the other txs in these 3 hours
+		p := 3 / (others + 168)
+		anomalies = append(anomalies, Anomaly{
+			TxID: tx.TxID, Time: txTime, Value: float64(how), Score: -math.Log10(p),
+			Baseline: fmt.Sprintf("%s, none of the other %d txs within an hour of it, busiest %s (%d txs)",
+				hourOfWeekLabel(how), len(sorted)-1, hourOfWeekLabel(busiest), counts[busiest]),
+		})
+	}
+	return anomalies
+}
+
+type ChangePoint struct {
+	Date       string
+	Score      float64
+	MeanBefore float64
+	MeanAfter  float64
+}
+
+// Binary segmentation on the daily volume series: the split where the
+// days before and after differ most by rank (Mann-Whitney z), recursing on
+// both halves. Ranks keep one huge day or a run of quiet days from
+// masking a level shift
+func detectChangePoints(days []string, volumes []float64, found *[]ChangePoint) {
+	n := len(volumes)
+	if n < 2*MIN_SEGMENT_DAYS || len(*found) >= MAX_CHANGEPOINTS {
+		return
+	}
+
+	ranks := averageRanks(volumes)
+	best, bestScore := -1, 0.0
+	var rankSum float64
+	for k := 1; k <= n-MIN_SEGMENT_DAYS; k++ {
+		rankSum += ranks[k-1]
+		if k < MIN_SEGMENT_DAYS {
+			continue
+		}
+		expected := float64(k) * float64(n+1) / 2
+		sd := math.Sqrt(float64(k) * float64(n-k) * float64(n+1) / 12)
+		if score := math.Abs(rankSum-expected) / sd; score > bestScore {
+			best, bestScore = k, score
+		}
+	}
+	if best < 0 || bestScore < CHANGEPOINT_SCORE {
+		return
+	}
+
+	*found = append(*found, ChangePoint{Date: days[best], Score: bestScore, MeanBefore: mean(volumes[:best]), MeanAfter: mean(volumes[best:])})
+	detectChangePoints(days[:best], volumes[:best], found)
+	detectChangePoints(days[best:], volumes[best:], found)
+}
+
+// 1-based ranks, ties get the average of the ranks they span
+func averageRanks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+	ranks := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j < len(order) && values[order[j]] == values[order[i]] {
+			j++
+		}
+		for k := i; k < j; k++ {
+			ranks[order[k]] = float64(i+j+1) / 2
+		}
+		i = j
+	}
+	return ranks
+}
+
+func mean(values []float64) float64 {
+	var total float64
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+// Daily volume from the first to the last tx, quiet days included
+func dailyVolumeSeries(sorted []Transaction, txDetails map[string]TransactionDetails) ([]string, []float64) {
+	if len(sorted) == 0 {
+		return nil, nil
+	}
+	byDay := make(map[string]float64)
+	for _, tx := range sorted {
+		byDay[time.Unix(int64(tx.Time), 0).UTC().Format("2006-01-02")] += walletVolume(txDetails[tx.TxID])
+	}
+	first := time.Unix(int64(sorted[0].Time), 0).UTC().Truncate(24 * time.Hour)
+	last := time.Unix(int64(sorted[len(sorted)-1].Time), 0).UTC()
+
+	var days []string
+	var volumes []float64
+	for day := first; !day.After(last); day = day.Add(24 * time.Hour) {
+		key := day.Format("2006-01-02")
+		days = append(days, key)
+		volumes = append(volumes, byDay[key])
+	}
+	return days, volumes
+}
+
+func printAnomalies(title string, anomalies []Anomaly, format func(Anomaly) string) {
+	fmt.Printf("\n%s%s:%s\n", Cyan, title, Reset)
+	if len(anomalies) == 0 {
+		fmt.Printf("- None\n")
+		return
+	}
+	for _, a := range anomalies {
+		fmt.Printf("- %s %s: %s (score %.2f; %s)\n", a.Time.UTC().Format("2006-01-02 15:04"), a.TxID, format(a), a.Score, a.Baseline)
+	}
+}
+
+func analyzeAnomalies(transactions []Transaction, txDetails map[string]TransactionDetails) ([]analysis.Finding, Metrics) {
+	var findings []analysis.Finding
+	sorted := sortedByTime(transactions)
+
+	fmt.Printf("\n%s=== Anomaly Detection ===%s\n", Yellow, Reset)
+	if len(sorted) < MIN_BASELINE+1 {
+		fmt.Printf("- Not enough history (%d transactions, need %d)\n", len(sorted), MIN_BASELINE+1)
+		return nil, nil
+	}
+
+	amounts := amountAnomalies(sorted, txDetails)
+	printAnomalies("Amounts (rolling median/MAD z-score)", amounts, func(a Anomaly) string {
+		return fmt.Sprintf("%.8f BTC", a.Value)
+	})
+	for _, a := range amounts {
+		findings = append(findings, analysis.Finding{
+			ID: "anomaly.amount", Severity: analysis.Low, TxIDs: []string{a.TxID},
+			Message: fmt.Sprintf("Amount %.8f BTC has z-score %.1f against %s", a.Value, a.Score, a.Baseline),
+		})
+	}
+
+	gaps := interArrivalAnomalies(sorted)
+	printAnomalies("Timing (inter-arrival, exponential model)", gaps, func(a Anomaly) string {
+		return fmt.Sprintf("gap %s", time.Duration(a.Value)*time.Second)
+	})
+	for _, a := range gaps {
+		findings = append(findings, analysis.Finding{
+			ID: "anomaly.interarrival", Severity: analysis.Info, TxIDs: []string{a.TxID},
+			Message: fmt.Sprintf("Timing score %.1f: %s", a.Score, a.Baseline),
+		})
+	}
+
+	seasonal := seasonalAnomalies(sorted)
+	if len(sorted) < MIN_SEASONAL_TXS {
+		fmt.Printf("\n%sHour of Week:%s\n- Needs %d transactions for a baseline\n", Cyan, Reset, MIN_SEASONAL_TXS)
+	} else {
+		printAnomalies("Hour of Week", seasonal, func(a Anomaly) string {
+			return "off-hours activity"
+		})
+	}
+	for _, a := range seasonal {
+		findings = append(findings, analysis.Finding{
+			ID: "anomaly.hour-of-week", Severity: analysis.Info, TxIDs: []string{a.TxID},
+			Message: "Activity outside the usual hours: " + a.Baseline,
+		})
+	}
+
+	days, volumes := dailyVolumeSeries(sorted, txDetails)
+	var changePoints []ChangePoint
+	detectChangePoints(days, volumes, &changePoints)
+	sort.Slice(changePoints, func(i, j int) bool {
+		return changePoints[i].Date < changePoints[j].Date
+	})
+	fmt.Printf("\n%sDaily Volume Change Points:%s\n", Cyan, Reset)
+	if len(days) < 2*MIN_SEGMENT_DAYS {
+		fmt.Printf("- Needs %d days of history (have %d)\n", 2*MIN_SEGMENT_DAYS, len(days))
+	} else if len(changePoints) == 0 {
+		fmt.Printf("- None\n")
+	}
+	for _, cp := range changePoints {
+		fmt.Printf("- %s: mean daily volume %.8f -> %.8f BTC (score %.2f)\n", cp.Date, cp.MeanBefore, cp.MeanAfter, cp.Score)
+		findings = append(findings, analysis.Finding{
+			ID: "anomaly.changepoint", Severity: analysis.Info,
+			Message: fmt.Sprintf("Daily volume shifted on %s from %.8f to %.8f BTC/day (score %.1f)", cp.Date, cp.MeanBefore, cp.MeanAfter, cp.Score),
+		})
+	}
+	return findings, Metrics{
+		"amount_anomalies":     float64(len(amounts)),
+		"timing_anomalies":     float64(len(gaps)),
+		"off_hours_txs":        float64(len(seasonal)),
+		"volume_change_points": float64(len(changePoints)),
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestRobustSpread(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		spread float64
+	}{
+		{"scaled MAD", []float64{1, 2, 3, 4, 5}, 1.4826},
+		{"mean deviation when most values are equal", []float64{1, 1, 1, 1, 10}, 1.2533 * 9 / 5},
+		{"constant", []float64{2, 2, 2}, 0},
+	}
+	for _, tt := range tests {
+		if got := robustSpread(tt.values, median(tt.values)); math.Abs(got-tt.spread) > 1e-9 {
+			t.Errorf("%s: spread %v, want %v", tt.name, got, tt.spread)
+		}
+	}
+}
+
+func TestAverageRanks(t *testing.T) {
+	tests := []struct {
+		values []float64
+		ranks  []float64
+	}{
+		{[]float64{30, 10, 20}, []float64{3, 1, 2}},
+		{[]float64{10, 20, 20, 30}, []float64{1, 2.5, 2.5, 4}},
+		{[]float64{5, 5, 5}, []float64{2, 2, 2}},
+	}
+	for _, tt := range tests {
+		if got := averageRanks(tt.values); fmt.Sprint(got) != fmt.Sprint(tt.ranks) {
+			t.Errorf("ranks of %v: %v, want %v", tt.values, got, tt.ranks)
+		}
+	}
+}
+
+func TestDetectChangePoints(t *testing.T) {
+	var days []string
+	var shifted, flat []float64
+	for i := 0; i < 28; i++ {
+		days = append(days, fmt.Sprintf("day%02d", i))
+		flat = append(flat, 1)
+		if i < 14 {
+			shifted = append(shifted, 1+float64(i%3)*0.1)
+		} else {
+			shifted = append(shifted, 10+float64(i%3))
+		}
+	}
+
+	var found []ChangePoint
+	detectChangePoints(days, shifted, &found)
+	if len(found) != 1 || found[0].Date != "day14" {
+		t.Fatalf("change points %+v, want one at day14", found)
+	}
+	if found[0].Score < CHANGEPOINT_SCORE || found[0].MeanAfter <= found[0].MeanBefore {
+		t.Errorf("change point %+v, want a rise scoring at least %v", found[0], CHANGEPOINT_SCORE)
+	}
+
+	found = nil
+	detectChangePoints(days, flat, &found)
+	if len(found) != 0 {
+		t.Errorf("flat series: change points %+v, want none", found)
+	}
+
+	found = nil
+	detectChangePoints(days[:2*MIN_SEGMENT_DAYS-1], shifted[:2*MIN_SEGMENT_DAYS-1], &found)
+	if len(found) != 0 {
+		t.Errorf("short series: change points %+v, want none", found)
+	}
+}
+
+func TestAmountAnomalies(t *testing.T) {
+	var txs []Transaction
+	details := make(map[string]TransactionDetails)
+	for i, amount := range []float64{1, 1.1, 0.9, 1.05, 0.95, 1, 1.02, 50, 0.98} {
+		txid := fmt.Sprintf("tx%d", i)
+		txs = append(txs, Transaction{TxID: txid, Time: 1_700_000_000 + i*3600})
+		details[txid] = TransactionDetails{Amount: amount}
+	}
+	anomalies := amountAnomalies(txs, details)
+	if len(anomalies) != 1 || anomalies[0].TxID != "tx7" {
+		t.Fatalf("anomalies %+v, want only tx7", anomalies)
+	}
+	if anomalies[0].Score <= MAD_Z_THRESHOLD {
+		t.Errorf("score %v, want above %v", anomalies[0].Score, MAD_Z_THRESHOLD)
+	}
+}
+
+func TestInterArrivalAnomalies(t *testing.T) {
+	at := func(offsets ...int) []Transaction {
+		var txs []Transaction
+		for i, offset := range offsets {
+			txs = append(txs, Transaction{TxID: fmt.Sprintf("tx%d", i), Time: 1_700_000_000 + offset})
+		}
+		return txs
+	}
+	tests := []struct {
+		name      string
+		txs       []Transaction
+		anomalies []string
+	}{
+		{"regular", at(0, 3600, 7200, 10800, 14400, 18000, 21600, 25200), nil},
+		{"same block", at(0, 3600, 3600, 3600, 7200, 10800, 14400, 18000, 21600, 21600, 25200), nil},
+		{"seconds apart", at(0, 3600, 7200, 7205, 10800, 14400, 18000, 21600, 25200), []string{"tx3"}},
+		{"too few arrivals", at(0, 0, 0, 0, 0, 0, 0, 3600), nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, a := range interArrivalAnomalies(tt.txs) {
+			got = append(got, a.TxID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.anomalies) {
+			t.Errorf("%s: anomalies %v, want %v", tt.name, got, tt.anomalies)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Payment/change label for one output of a tx the wallet sent
+type OutputRole struct {
+	Index      int
+	Addr       string
+	Value      int64
+	Change     bool
+	Confidence float64
+	Reasons    []string
+}
+
+// Amounts treated as "round" by the round-payment heuristic (sats)
+const roundAmountUnit = 100_000
+
+// Labels each output of a tx as payment or change using the usual
+// heuristics: address reuse, script type matching, round payments,
+// unnecessary inputs and optimal change
+func detectChange(tx Transaction, address string) []OutputRole {
+	roles := make([]OutputRole, len(tx.Out))
+	for i, out := range tx.Out {
+		roles[i] = OutputRole{Index: i, Addr: out.Addr, Value: out.Value}
+	}
+	if len(tx.Out) == 0 {
+		return roles
+	}
+	if len(tx.Out) == 1 {
+		roles[0].Confidence = 1
+		roles[0].Reasons = []string{"single output, no change"}
+		return roles
+	}
+
+	inputAddrs := make(map[string]bool)
+	inputTypes := make(map[AddressType]bool)
+	var sumIn int64
+	minIn := int64(math.MaxInt64)
+	for _, in := range tx.Inputs {
+		inputAddrs[in.PrevOut.Addr] = true
+		inputTypes[addressType(in.PrevOut.Addr)] = true
+		sumIn += in.PrevOut.Value
+		if in.PrevOut.Value < minIn {
+			minIn = in.PrevOut.Value
+		}
+	}
+	var inputType AddressType
+	if len(inputTypes) == 1 {
+		for t := range inputTypes {
+			inputType = t
+		}
+	}
+
+	var typeMatches int
+	for _, out := range tx.Out {
+		if inputType != "" && addressType(out.Addr) == inputType {
+			typeMatches++
+		}
+	}
+
+	scores := make([]float64, len(tx.Out))
+	for i, out := range tx.Out {
+		addReason := func(score float64, reason string) {
+			scores[i] += score
+			roles[i].Reasons = append(roles[i].Reasons, reason)
+		}
+
+		if out.Addr == address && address != "" {
+			addReason(10, "returns to the watched address")
+		} else if inputAddrs[out.Addr] {
+			addReason(3, "address reuse: pays back to an input address")
+		}
+
+		// Only informative when it singles out some of the outputs
+		if inputType != "" && typeMatches < len(tx.Out) && addressType(out.Addr) == inputType {
+			addReason(1, fmt.Sprintf("script type matches inputs (%s)", inputType))
+		}
+
+		if out.Value%roundAmountUnit == 0 {
+			addReason(-1.5, "round amount, looks like a payment")
+		}
+
+		// If this were the payment, the smallest input wasn't needed
+		if len(tx.Inputs) > 1 && sumIn-minIn >= out.Value+tx.Fee {
+			addReason(1, "unnecessary input if this were the payment")
+		}
+
+		if len(tx.Inputs) > 0 && out.Value < minIn {
+			addReason(1, "optimal change: smaller than every input")
+		}
+	}
+
+	// The best scoring output is change if it clearly stands out
+	best := 0
+	for i, score := range scores {
+		if score > scores[best] {
+			best = i
+		}
+	}
+	second := math.Inf(-1)
+	for i, score := range scores {
+		if i != best {
+			second = math.Max(second, score)
+		}
+	}
+	margin := scores[best] - second
+	if scores[best] <= 0 || margin <= 0 {
+		for i := range roles {
+			roles[i].Confidence = 0.5
+		}
+		return roles
+	}
+
+	confidence := math.Min(0.99, margin/(margin+1))
+	if tx.Out[best].Addr == address {
+		confidence = 0.99
+	}
+	for i := range roles {
+		roles[i].Change = i == best
+		roles[i].Confidence = confidence
+	}
+	return roles
+}
+
+// Payment outputs and their total for a tx the wallet sent
+func paymentOutputs(roles []OutputRole) ([]string, int64) {
+	var payees []string
+	var total int64
+	for _, role := range roles {
+		if role.Change {
+			continue
+		}
+		payees = append(payees, role.Addr)
+		total += role.Value
+	}
+	return payees, total
+}
+
+// Input addresses of tx other than the wallet's own, in input order
+func senderAddresses(tx Transaction, address string) []string {
+	seen := make(map[string]bool)
+	var senders []string
+	for _, in := range tx.Inputs {
+		addr := in.PrevOut.Addr
+		if addr == "" || addr == address || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		senders = append(senders, addr)
+	}
+	return senders
+}
+
+func printChangeAnalysis(transactions []Transaction, address string) {
+	var lines []string
+	for _, tx := range transactions {
+		if !paidByWallet(tx, address) {
+			continue
+		}
+		roles := detectChange(tx, address)
+		payees, amount := paymentOutputs(roles)
+
+		line := fmt.Sprintf("%s: paid %.8f BTC to %s", tx.TxID, float64(amount)/100_000_000, formatAddresses(payees, 2))
+		for _, role := range roles {
+			if role.Change {
+				line += fmt.Sprintf("\n    change: %s %.8f BTC (%.0f%% confidence: %s)",
+					role.Addr, float64(role.Value)/100_000_000, role.Confidence*100, strings.Join(role.Reasons, ", "))
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s=== Payments and Change ===%s\n\n", Yellow, Reset)
+	for _, line := range lines {
+		fmt.Printf("- %s\n", line)
+	}
+}
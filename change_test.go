@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Script types the change heuristics look at
+const (
+	testWatched = "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"                   // P2WPKH
+	testSegwit  = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"                     // P2WPKH
+	testTaproot = "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0" // P2TR
+	testLegacy  = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"                             // P2PKH
+	testScript  = "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"                             // P2SH
+)
+
+type testIO struct {
+	addr  string
+	value int64
+}
+
+func testTx(txid string, time int, ins []testIO, outs []testIO) Transaction {
+	tx := Transaction{TxID: txid, Time: time, BlockHeight: 1, Fee: 1_000}
+	for i, in := range ins {
+		var input Input
+		input.PrevOut.Addr = in.addr
+		input.PrevOut.Value = in.value
+		input.PrevOut.TxID = txid + "-prev"
+		input.PrevOut.N = i
+		input.Sequence = 0xffffffff
+		tx.Inputs = append(tx.Inputs, input)
+	}
+	for i, out := range outs {
+		tx.Out = append(tx.Out, Output{Addr: out.addr, Value: out.value, N: i})
+	}
+	return tx
+}
+
+func TestDetectChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      Transaction
+		address string
+		change  int // index of the change output, -1 for none
+	}{
+		{
+			name:    "back to the watched address",
+			tx:      testTx("a", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 30_000_000}, {testWatched, 69_999_000}}),
+			address: testWatched,
+			change:  1,
+		},
+		{
+			name:   "round payment, change matches the input script",
+			tx:     testTx("b", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 50_000_000}, {testSegwit, 49_999_000}}),
+			change: 1,
+		},
+		{
+			name:   "larger output is the change",
+			tx:     testTx("c", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testSegwit, 90_123_456}, {testLegacy, 9_875_544}}),
+			change: 0,
+		},
+		{
+			name:   "pays back to an input address",
+			tx:     testTx("d", 0, []testIO{{testTaproot, 100_000_000}}, []testIO{{testScript, 12_345_678}, {testTaproot, 87_653_322}}),
+			change: 1,
+		},
+		{
+			name:   "nothing tells the outputs apart",
+			tx:     testTx("e", 0, []testIO{{testTaproot, 100_000_000}}, []testIO{{testLegacy, 12_345_678}, {testScript, 87_653_322}}),
+			change: -1,
+		},
+		{
+			name:   "single output",
+			tx:     testTx("f", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 99_999_000}}),
+			change: -1,
+		},
+	}
+	for _, tt := range tests {
+		roles := detectChange(tt.tx, tt.address)
+		if len(roles) != len(tt.tx.Out) {
+			t.Errorf("%s: %d roles for %d outputs", tt.name, len(roles), len(tt.tx.Out))
+			continue
+		}
+		change := -1
+		for _, role := range roles {
+			if role.Change {
+				if change >= 0 {
+					t.Errorf("%s: more than one change output", tt.name)
+				}
+				change = role.Index
+			}
+		}
+		if change != tt.change {
+			t.Errorf("%s: change is output %d, want %d (%+v)", tt.name, change, tt.change, roles)
+		}
+	}
+}
+
+func TestDetectChangeConfidence(t *testing.T) {
+	tx := testTx("a", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 30_000_000}, {testWatched, 69_999_000}})
+	for _, role := range detectChange(tx, testWatched) {
+		if role.Confidence != 0.99 {
+			t.Errorf("output %d: confidence %.2f, want 0.99 when change returns to the watched address", role.Index, role.Confidence)
+		}
+	}
+
+	tx = testTx("e", 0, []testIO{{testTaproot, 100_000_000}}, []testIO{{testLegacy, 12_345_678}, {testScript, 87_653_322}})
+	for _, role := range detectChange(tx, "") {
+		if role.Confidence != 0.5 {
+			t.Errorf("output %d: confidence %.2f, want 0.5 without a clear change output", role.Index, role.Confidence)
+		}
+	}
+}
+
+func TestPaymentOutputs(t *testing.T) {
+	tx := testTx("b", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 50_000_000}, {testSegwit, 49_999_000}})
+	payees, total := paymentOutputs(detectChange(tx, testWatched))
+	if len(payees) != 1 || payees[0] != testLegacy || total != 50_000_000 {
+		t.Errorf("payees %v total %d, want [%s] 50000000", payees, total, testLegacy)
+	}
+}
+
+func TestSenderAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      Transaction
+		senders []string
+	}{
+		{"wallet left out", testTx("a", 0, []testIO{{testWatched, 1}, {testLegacy, 1}}, nil), []string{testLegacy}},
+		{"deduplicated", testTx("b", 0, []testIO{{testSegwit, 1}, {testLegacy, 1}, {testSegwit, 1}}, nil), []string{testSegwit, testLegacy}},
+		{"own change", testTx("c", 0, []testIO{{testWatched, 1}}, nil), nil},
+	}
+	for _, tt := range tests {
+		if got := senderAddresses(tt.tx, testWatched); fmt.Sprint(got) != fmt.Sprint(tt.senders) {
+			t.Errorf("%s: senders %v, want %v", tt.name, got, tt.senders)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Union-find over addresses. Addresses spent together as inputs of one tx
+// are assumed to belong to the same entity (common-input-ownership)
+type Clusters struct {
+	parent map[string]string
+	size   map[string]int
+}
+
+func newClusters() *Clusters {
+	return &Clusters{
+		parent: make(map[string]string),
+		size:   make(map[string]int),
+	}
+}
+
+func (c *Clusters) Find(addr string) string {
+	if _, ok := c.parent[addr]; !ok {
+		c.parent[addr] = addr
+		c.size[addr] = 1
+		return addr
+	}
+	root := addr
+	for c.parent[root] != root {
+		root = c.parent[root]
+	}
+	// Path compression
+	for c.parent[addr] != root {
+		next := c.parent[addr]
+		c.parent[addr] = root
+		addr = next
+	}
+	return root
+}
+
+func (c *Clusters) Union(a, b string) {
+	rootA, rootB := c.Find(a), c.Find(b)
+	if rootA == rootB {
+		return
+	}
+	if c.size[rootA] < c.size[rootB] {
+		rootA, rootB = rootB, rootA
+	}
+	c.parent[rootB] = rootA
+	c.size[rootA] += c.size[rootB]
+}
+
+func (c *Clusters) AddTransaction(tx Transaction) {
+	var first string
+	for _, in := range tx.Inputs {
+		addr := in.PrevOut.Addr
+		if addr == "" {
+			continue
+		}
+		if first == "" {
+			first = addr
+			c.Find(addr)
+			continue
+		}
+		c.Union(first, addr)
+	}
+}
+
+// Addresses grouped by cluster root, each group sorted
+func (c *Clusters) Groups() map[string][]string {
+	groups := make(map[string][]string)
+	for addr := range c.parent {
+		root := c.Find(addr)
+		groups[root] = append(groups[root], addr)
+	}
+	for _, members := range groups {
+		sort.Strings(members)
+	}
+	return groups
+}
+
+func (c *Clusters) Size(addr string) int {
+	return c.size[c.Find(addr)]
+}
+
+func buildClusters(transactions []Transaction) *Clusters {
+	clusters := newClusters()
+	for _, tx := range transactions {
+		clusters.AddTransaction(tx)
+	}
+	return clusters
+}
+
+// One hop expansion: pulls the history of up to limit counterparties so
+// their own co-spends can merge clusters seen only partially from here
+func expandClusters(clusters *Clusters, transactions []Transaction, address string, limit int) {
+	seen := map[string]bool{address: true}
+	var counterparties []string
+	for _, tx := range transactions {
+		for _, in := range tx.Inputs {
+			if addr := in.PrevOut.Addr; addr != "" && !seen[addr] {
+				seen[addr] = true
+				counterparties = append(counterparties, addr)
+			}
+		}
+		for _, out := range tx.Out {
+			if addr := out.Addr; addr != "" && !seen[addr] {
+				seen[addr] = true
+				counterparties = append(counterparties, addr)
+			}
+		}
+	}
+
+	if len(counterparties) > limit {
+		counterparties = counterparties[:limit]
+	}
+	for _, addr := range counterparties {
+		wallet, err := backend.FetchWallet(addr)
+		if err != nil {
+			log.Printf("Error expanding cluster for %s: %v", addr, err)
+			continue
+		}
+		for _, tx := range wallet.Transactions {
+			clusters.AddTransaction(tx)
+		}
+	}
+}
+
+// Short name for the cluster an address belongs to
+func describeCluster(clusters *Clusters, addr string) string {
+	if clusters == nil {
+		return labelAddress(addr)
+	}
+	if size := clusters.Size(addr); size > 1 {
+		return fmt.Sprintf("%s (+%d linked)", labelAddress(addr), size-1)
+	}
+	return labelAddress(addr)
+}
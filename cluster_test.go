@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Backend stand-in serving wallet histories on top of testFetcher
+type testBackend struct {
+	testFetcher
+	wallets map[string][]Transaction
+}
+
+func (b *testBackend) FetchWallet(address string) (*WalletResponse, error) {
+	b.requests++
+	txs, ok := b.wallets[address]
+	if !ok {
+		return nil, fmt.Errorf("no wallet %s", address)
+	}
+	return &WalletResponse{Address: address, Transactions: txs}, nil
+}
+
+func (b *testBackend) TransactionAmount(address string, tx Transaction) (int64, error) {
+	return netAmount(address, tx), nil
+}
+
+func TestClusters(t *testing.T) {
+	c := newClusters()
+	if root := c.Find("a"); root != "a" || c.Size("a") != 1 {
+		t.Errorf("new address: root %s size %d, want itself and 1", root, c.Size("a"))
+	}
+
+	for _, pair := range [][2]string{{"a", "b"}, {"c", "d"}, {"d", "e"}, {"b", "c"}, {"a", "e"}} {
+		c.Union(pair[0], pair[1])
+	}
+	c.Find("f")
+	groups := c.Groups()
+	if len(groups) != 2 || c.Size("e") != 5 || c.Size("f") != 1 {
+		t.Errorf("groups %v, want a..e together and f alone", groups)
+	}
+	if members := groups[c.Find("a")]; fmt.Sprint(members) != "[a b c d e]" {
+		t.Errorf("members %v, want them sorted", members)
+	}
+	root := c.Find("a")
+	for _, addr := range []string{"a", "b", "c", "d", "e"} {
+		c.Find(addr)
+		if c.parent[addr] != root {
+			t.Errorf("%s points at %s, want it compressed onto %s", addr, c.parent[addr], root)
+		}
+	}
+}
+
+func TestBuildClusters(t *testing.T) {
+	clusters := buildClusters([]Transaction{
+		testTx("a", 0, []testIO{{testLegacy, 1}, {testSegwit, 1}}, []testIO{{testScript, 1}}),
+		testTx("b", 0, []testIO{{testSegwit, 1}, {testTaproot, 1}}, nil),
+		// Outputs don't link, only co-spent inputs
+		testTx("c", 0, []testIO{{testWatched, 1}}, []testIO{{testScript, 1}, {testLegacy, 1}}),
+	})
+	tests := []struct {
+		a, b   string
+		linked bool
+	}{
+		{testLegacy, testTaproot, true},
+		{testLegacy, testScript, false},
+		{testWatched, testLegacy, false},
+	}
+	for _, tt := range tests {
+		if linked := clusters.Find(tt.a) == clusters.Find(tt.b); linked != tt.linked {
+			t.Errorf("%s and %s linked %v, want %v", tt.a, tt.b, linked, tt.linked)
+		}
+	}
+}
+
+func TestExpandClusters(t *testing.T) {
+	history := []Transaction{
+		testTx("in", 0, []testIO{{testLegacy, 1_001_000}}, []testIO{{testWatched, 1_000_000}}),
+		testTx("out", 0, []testIO{{testWatched, 1_000_000}}, []testIO{{testSegwit, 999_000}}),
+	}
+	test := &testBackend{wallets: map[string][]Transaction{
+		testLegacy: {testTx("l", 0, []testIO{{testLegacy, 1}, {testTaproot, 1}}, nil)},
+		testSegwit: {testTx("s", 0, []testIO{{testSegwit, 1}, {testScript, 1}}, nil)},
+	}}
+	saved := backend
+	backend = test
+	t.Cleanup(func() { backend = saved })
+
+	tests := []struct {
+		limit          int
+		requests       int
+		legacy, segwit bool
+	}{
+		{1, 1, true, false},
+		{10, 2, true, true},
+	}
+	for _, tt := range tests {
+		test.requests = 0
+		clusters := buildClusters(history)
+		expandClusters(clusters, history, testWatched, tt.limit)
+		legacy := clusters.Find(testLegacy) == clusters.Find(testTaproot)
+		segwit := clusters.Find(testSegwit) == clusters.Find(testScript)
+		if test.requests != tt.requests || legacy != tt.legacy || segwit != tt.segwit {
+			t.Errorf("limit %d: %d requests, linked %v %v, want %d, %v %v",
+				tt.limit, test.requests, legacy, segwit, tt.requests, tt.legacy, tt.segwit)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+type CoinJoinMatch struct {
+	Kind         string // Whirlpool, Wasabi, JoinMarket or generic
+	Denomination int64
+	EqualOutputs int
+	Inputs       int
+}
+
+func (m *CoinJoinMatch) String() string {
+	return fmt.Sprintf("%s CoinJoin (%d x %.8f BTC, %d inputs)",
+		m.Kind, m.EqualOutputs, float64(m.Denomination)/100_000_000, m.Inputs)
+}
+
+// Whirlpool pool sizes in sats
+var whirlpoolPools = map[int64]bool{
+	100_000:    true,
+	1_000_000:  true,
+	5_000_000:  true,
+	50_000_000: true,
+}
+
+const (
+	MIN_EQUAL_OUTPUTS      = 3
+	WASABI_MIN_INPUTS      = 50
+	WASABI_V1_DENOMINATION = 10_000_000 // ~0.1 BTC base denomination of Wasabi 1.x
+	WASABI_V1_TOLERANCE    = 1_000_000
+)
+
+// Recognises equal-output CoinJoins and the coordinator signatures of
+// Whirlpool, Wasabi and JoinMarket. Returns nil for ordinary txs
+func detectCoinJoin(tx Transaction) *CoinJoinMatch {
+	counts := make(map[int64]int)
+	for _, out := range tx.Out {
+		counts[out.Value]++
+	}
+
+	var denomination int64
+	var equal, distinctGroups int
+	for value, count := range counts {
+		if count >= 2 {
+			distinctGroups++
+		}
+		if count > equal || (count == equal && value > denomination) {
+			denomination, equal = value, count
+		}
+	}
+	if equal < MIN_EQUAL_OUTPUTS || len(tx.Inputs) < equal {
+		return nil
+	}
+
+	match := &CoinJoinMatch{Denomination: denomination, EqualOutputs: equal, Inputs: len(tx.Inputs)}
+	switch {
+	// Whirlpool mixes are always 5 in, 5 equal out at a pool size
+	case len(tx.Inputs) == 5 && len(tx.Out) == 5 && equal == 5 && whirlpoolPools[denomination]:
+		match.Kind = "Whirlpool"
+	// Wasabi 1.x: large rounds around 0.1 BTC. Wasabi 2 uses many
+	// standard denominations, so several equal-output groups
+	case len(tx.Inputs) >= WASABI_MIN_INPUTS &&
+		(abs64(denomination-WASABI_V1_DENOMINATION) <= WASABI_V1_TOLERANCE || distinctGroups >= 5):
+		match.Kind = "Wasabi"
+	// JoinMarket: one equal output plus about one change output per participant
+	case len(tx.Out) >= 2*equal-1 && len(tx.Out) <= 2*equal+1 && equal <= 20:
+		match.Kind = "JoinMarket"
+	default:
+		match.Kind = "Equal-output"
+	}
+	return match
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
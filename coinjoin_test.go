@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+// Tx with n inputs and the given output values
+func testCoinJoin(inputs int, outputs ...int64) Transaction {
+	var ins, outs []testIO
+	for i := 0; i < inputs; i++ {
+		ins = append(ins, testIO{testSegwit, 1})
+	}
+	for _, value := range outputs {
+		outs = append(outs, testIO{testLegacy, value})
+	}
+	return testTx("cj", 0, ins, outs)
+}
+
+// n outputs of value
+func repeat(n int, value int64) []int64 {
+	var values []int64
+	for i := 0; i < n; i++ {
+		values = append(values, value)
+	}
+	return values
+}
+
+func concat(groups ...[]int64) []int64 {
+	var values []int64
+	for _, group := range groups {
+		values = append(values, group...)
+	}
+	return values
+}
+
+func TestDetectCoinJoin(t *testing.T) {
+	tests := []struct {
+		name  string
+		tx    Transaction
+		kind  string // "" = not a CoinJoin
+		equal int
+	}{
+		{"whirlpool", testCoinJoin(5, repeat(5, 1_000_000)...), "Whirlpool", 5},
+		{"whirlpool shape off the pool sizes", testCoinJoin(5, repeat(5, 1_234_567)...), "Equal-output", 5},
+		{"wasabi 1 around 0.1 BTC", testCoinJoin(60, concat(repeat(40, 10_050_000), []int64{3_000_000, 4_000_000})...), "Wasabi", 40},
+		{
+			"wasabi 2 standard denominations",
+			testCoinJoin(60, concat(repeat(4, 5_000), repeat(3, 10_000), repeat(2, 20_000), repeat(2, 50_000), repeat(2, 100_000))...),
+			"Wasabi", 4,
+		},
+		{"joinmarket equal outputs plus change", testCoinJoin(4, concat(repeat(4, 2_000_000), []int64{111, 222, 333})...), "JoinMarket", 4},
+		{"payment with change", testCoinJoin(1, 5_000_000, 94_999_000), "", 0},
+		{"two equal outputs", testCoinJoin(3, 1_000_000, 1_000_000, 5_000), "", 0},
+		{"batch payout from fewer inputs", testCoinJoin(2, repeat(3, 1_000_000)...), "", 0},
+	}
+	for _, tt := range tests {
+		match := detectCoinJoin(tt.tx)
+		if tt.kind == "" {
+			if match != nil {
+				t.Errorf("%s: detected %s, want none", tt.name, match)
+			}
+			continue
+		}
+		if match == nil || match.Kind != tt.kind || match.EqualOutputs != tt.equal {
+			t.Errorf("%s: detected %+v, want %s with %d equal outputs", tt.name, match, tt.kind, tt.equal)
+		}
+	}
+}
+
+func TestCoinJoinMatchString(t *testing.T) {
+	match := detectCoinJoin(testCoinJoin(5, repeat(5, 5_000_000)...))
+	if got, want := match.String(), "Whirlpool CoinJoin (5 x 0.05000000 BTC, 5 inputs)"; got != want {
+		t.Errorf("%q, want %q", got, want)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	MAX_COMPARE_LIST      = 10 // shared counterparties and transfers listed per pair
+	COMPARE_ADDRESS_WIDTH = 24 // display cells per address in transfer and activity lines
+)
+
+// Direct payment from one compared wallet to another
+type Transfer struct {
+	TxID   string
+	From   string
+	To     string
+	Amount int64 // sats received by To
+	Time   time.Time
+}
+
+// What a compared wallet did, all derived from its fetched history
+type walletProfile struct {
+	Address        string
+	Transactions   []Transaction
+	Counterparties map[string]bool
+	ActiveDays     map[string]bool
+	First, Last    time.Time
+	Received, Sent int64
+	Fingerprint    Fingerprint
+}
+
+func newWalletProfile(address string, transactions []Transaction) *walletProfile {
+	p := &walletProfile{
+		Address:        address,
+		Transactions:   transactions,
+		Counterparties: make(map[string]bool),
+		ActiveDays:     make(map[string]bool),
+		Fingerprint:    buildFingerprint(transactions),
+	}
+	for _, tx := range transactions {
+		for _, in := range tx.Inputs {
+			if in.PrevOut.Addr != "" && in.PrevOut.Addr != address {
+				p.Counterparties[in.PrevOut.Addr] = true
+			}
+		}
+		for _, out := range tx.Out {
+			if out.Addr != "" && out.Addr != address {
+				p.Counterparties[out.Addr] = true
+			}
+		}
+
+		if amount := netAmount(address, tx); amount > 0 {
+			p.Received += amount
+		} else {
+			p.Sent -= amount
+		}
+
+		if tx.Time == 0 {
+			continue
+		}
+		t := time.Unix(int64(tx.Time), 0).UTC()
+		p.ActiveDays[t.Format("2006-01-02")] = true
+		if p.First.IsZero() || t.Before(p.First) {
+			p.First = t
+		}
+		if t.After(p.Last) {
+			p.Last = t
+		}
+	}
+	return p
+}
+
+// Txs where from spends and to receives. Both wallets' histories hold
+// them, so they are deduplicated by txid
+func directTransfers(from, to *walletProfile) []Transfer {
+	seen := make(map[string]bool)
+	var transfers []Transfer
+	for _, txs := range [][]Transaction{from.Transactions, to.Transactions} {
+		for _, tx := range txs {
+			// Co-spends pay change, not each other
+			if seen[tx.TxID] || !paidByWallet(tx, from.Address) || paidByWallet(tx, to.Address) {
+				continue
+			}
+			var amount int64
+			for _, out := range tx.Out {
+				if out.Addr == to.Address {
+					amount += out.Value
+				}
+			}
+			if amount == 0 {
+				continue
+			}
+			seen[tx.TxID] = true
+			transfers = append(transfers, Transfer{
+				TxID: tx.TxID, From: from.Address, To: to.Address, Amount: amount,
+				Time: time.Unix(int64(tx.Time), 0),
+			})
+		}
+	}
+	return transfers
+}
+
+// Txs where both addresses are inputs, the common-input-ownership link
+func coSpends(a, b *walletProfile) []string {
+	var txids []string
+	for _, tx := range a.Transactions {
+		if paidByWallet(tx, a.Address) && paidByWallet(tx, b.Address) {
+			txids = append(txids, tx.TxID)
+		}
+	}
+	return txids
+}
+
+func printComparePair(a, b *walletProfile, clusters *Clusters) {
+	fmt.Printf("\n%s=== %s vs %s ===%s\n\n", Yellow, labelAddress(a.Address), labelAddress(b.Address), Reset)
+
+	var evidence []string
+	if txids := coSpends(a, b); len(txids) > 0 {
+		evidence = append(evidence, fmt.Sprintf("spent together as inputs in %s", formatList(txids, 3)))
+	} else if clusters.Find(a.Address) == clusters.Find(b.Address) {
+		evidence = append(evidence, "same cluster through common-input-ownership")
+	}
+
+	// Shared counterparties, by address and by entity
+	var shared []string
+	for addr := range a.Counterparties {
+		if b.Counterparties[addr] && addr != b.Address {
+			shared = append(shared, addr)
+		}
+	}
+	sort.Strings(shared)
+	entitiesA := make(map[string]bool)
+	for addr := range a.Counterparties {
+		entitiesA[clusters.Find(addr)] = true
+	}
+	sharedEntities := make(map[string]bool)
+	for addr := range b.Counterparties {
+		root := clusters.Find(addr)
+		if entitiesA[root] && root != clusters.Find(a.Address) && root != clusters.Find(b.Address) {
+			sharedEntities[root] = true
+		}
+	}
+	fmt.Printf("%sShared Counterparties:%s %d addresses, %d entities\n", Cyan, Reset, len(shared), len(sharedEntities))
+	for i, addr := range shared {
+		if i == MAX_COMPARE_LIST {
+			fmt.Printf("- ... %d more\n", len(shared)-MAX_COMPARE_LIST)
+			break
+		}
+		fmt.Printf("- %s\n", labelAddress(addr))
+	}
+	if len(shared) > 0 {
+		evidence = append(evidence, fmt.Sprintf("%d shared counterparty addresses", len(shared)))
+	}
+
+	// Direct transfers both ways
+	transfers := append(directTransfers(a, b), directTransfers(b, a)...)
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].Time.Before(transfers[j].Time) })
+	fmt.Printf("\n%sDirect Transfers:%s %d\n", Cyan, Reset, len(transfers))
+	var aToB, bToA int64
+	for i, t := range transfers {
+		if t.From == a.Address {
+			aToB += t.Amount
+		} else {
+			bToA += t.Amount
+		}
+		if i < MAX_COMPARE_LIST {
+			fmt.Printf("- %s  %s -> %s  %.8f BTC  %s\n", t.Time.Format("2006-01-02 15:04:05"),
+				compareAddress(t.From), compareAddress(t.To), float64(t.Amount)/100_000_000, t.TxID)
+		}
+	}
+	if len(transfers) > 0 {
+		fmt.Printf("- Total: %.8f BTC from the first, %.8f BTC from the second\n",
+			float64(aToB)/100_000_000, float64(bToA)/100_000_000)
+		evidence = append(evidence, fmt.Sprintf("%d direct transfers", len(transfers)))
+	}
+
+	// Activity overlap
+	fmt.Printf("\n%sActive Time Windows:%s\n", Cyan, Reset)
+	for _, p := range []*walletProfile{a, b} {
+		if p.First.IsZero() {
+			fmt.Printf("- %s: no confirmed transactions\n", compareAddress(p.Address))
+			continue
+		}
+		fmt.Printf("- %s: %s to %s (%d active days)\n", compareAddress(p.Address),
+			p.First.Format("2006-01-02"), p.Last.Format("2006-01-02"), len(p.ActiveDays))
+	}
+	if !a.First.IsZero() && !b.First.IsZero() {
+		start, end := a.First, a.Last
+		if b.First.After(start) {
+			start = b.First
+		}
+		if b.Last.Before(end) {
+			end = b.Last
+		}
+		if end.Before(start) {
+			fmt.Printf("- No overlap, %s apart\n", start.Sub(end).Round(time.Hour))
+		} else {
+			fmt.Printf("- Overlap: %s to %s\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
+		}
+
+		common := 0
+		for day := range a.ActiveDays {
+			if b.ActiveDays[day] {
+				common++
+			}
+		}
+		union := len(a.ActiveDays) + len(b.ActiveDays) - common
+		fmt.Printf("- Active on the same day: %d days (%.0f%% of all active days)\n", common, 100*float64(common)/float64(union))
+	}
+
+	similarity := fingerprintSimilarity(a.Fingerprint, b.Fingerprint)
+	fmt.Printf("\n%sFingerprint Similarity:%s %.0f%%\n", Cyan, Reset, similarity*100)
+	if a.Fingerprint.OffsetKnown && b.Fingerprint.OffsetKnown {
+		fmt.Printf("- Timezones: %s vs %s\n", formatUTCOffset(a.Fingerprint.Offset), formatUTCOffset(b.Fingerprint.Offset))
+	}
+	if min(a.Fingerprint.Total, b.Fingerprint.Total) < MIN_FINGERPRINT_TXS {
+		fmt.Printf("- Fewer than %d transactions in one wallet, weak evidence\n", MIN_FINGERPRINT_TXS)
+	}
+
+	fmt.Printf("\n%sEvidence of a Relationship:%s\n", Cyan, Reset)
+	if len(evidence) == 0 {
+		fmt.Printf("- None found in the fetched history\n")
+	}
+	for _, e := range evidence {
+		fmt.Printf("- %s\n", e)
+	}
+}
+
+// In and out of the group as a whole, transfers between members excluded
+func printCombinedFlows(profiles []*walletProfile) {
+	members := make(map[string]bool)
+	for _, p := range profiles {
+		members[p.Address] = true
+	}
+
+	seen := make(map[string]bool)
+	var inflow, outflow, internal int64
+	for _, p := range profiles {
+		for _, tx := range p.Transactions {
+			if seen[tx.TxID] {
+				continue
+			}
+			seen[tx.TxID] = true
+
+			spenders := make(map[string]bool)
+			for _, in := range tx.Inputs {
+				if members[in.PrevOut.Addr] {
+					spenders[in.PrevOut.Addr] = true
+				}
+			}
+			for _, out := range tx.Out {
+				switch {
+				case len(spenders) == 0 && members[out.Addr]:
+					inflow += out.Value
+				case len(spenders) == 0 || spenders[out.Addr]:
+					// Unrelated tx or change back to the spender
+				case members[out.Addr]:
+					internal += out.Value
+				default:
+					outflow += out.Value
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\n%s=== Combined Flows (%d wallets) ===%s\n\n", Yellow, len(profiles), Reset)
+	var received, sent int64
+	for _, p := range profiles {
+		received += p.Received
+		sent += p.Sent
+		fmt.Printf("- %s: received %.8f BTC, sent %.8f BTC\n", labelAddress(p.Address),
+			float64(p.Received)/100_000_000, float64(p.Sent)/100_000_000)
+	}
+	fmt.Printf("- Inflow from outside the group: %.8f BTC\n", float64(inflow)/100_000_000)
+	fmt.Printf("- Outflow to outside the group: %.8f BTC\n", float64(outflow)/100_000_000)
+	fmt.Printf("- Moved between group wallets: %.8f BTC\n", float64(internal)/100_000_000)
+	fmt.Printf("- Net: %.8f BTC\n", float64(inflow-outflow)/100_000_000)
+}
+
+// Labelled address shortened to fit a compare line
+func compareAddress(addr string) string {
+	return abbreviateAddress(labelAddress(addr), COMPARE_ADDRESS_WIDTH)
+}
+
+// compare <address> <address> [...]
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	addresses := fs.Args()
+	if len(addresses) < 2 {
+		log.Fatal("Usage: compare [-network ...] <address> <address> [<address> ...]")
+	}
+	common.apply()
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if store, err := loadLabels(db); err == nil {
+		labels = store
+	}
+
+	var profiles []*walletProfile
+	var all []Transaction
+	for _, addr := range addresses {
+		if _, err := validateAddress(addr, network); err != nil {
+			log.Fatalf("Invalid wallet address %s: %v", addr, err)
+		}
+		wallet, err := backend.FetchWallet(addr)
+		if err != nil {
+			log.Fatalf("Error fetching wallet %s: %v", addr, err)
+		}
+		profiles = append(profiles, newWalletProfile(addr, wallet.Transactions))
+		all = append(all, wallet.Transactions...)
+	}
+
+	// One clustering over every history, so links through any wallet count
+	clusters := buildClusters(all)
+	labels.clusters = clusters
+
+	for i := range profiles {
+		for j := i + 1; j < len(profiles); j++ {
+			printComparePair(profiles[i], profiles[j], clusters)
+		}
+	}
+	printCombinedFlows(profiles)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompareAddress(t *testing.T) {
+	saved := labels
+	t.Cleanup(func() { labels = saved })
+	labels = &LabelStore{labels: map[string]Label{
+		labelKey("addr", testSegwit): {Type: "addr", Ref: testSegwit, Label: "Exchange", Category: "exchange"},
+	}}
+
+	tests := []struct {
+		addr, want string
+	}{
+		{testLegacy, truncateMiddle(testLegacy, COMPARE_ADDRESS_WIDTH)},
+		{testSegwit, truncateEnd(truncateMiddle(testSegwit, 12)+" [Exchange, exchange]", COMPARE_ADDRESS_WIDTH)},
+	}
+	for _, tt := range tests {
+		got := compareAddress(tt.addr)
+		if got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.addr, got, tt.want)
+		}
+		if displayWidth(got) > COMPARE_ADDRESS_WIDTH {
+			t.Errorf("%s: %q is wider than %d cells", tt.addr, got, COMPARE_ADDRESS_WIDTH)
+		}
+	}
+}
+
+func TestDirectTransfers(t *testing.T) {
+	// The payment shows up in both histories, the co-spend only pays change
+	payment := testTx("pay", 1_700_000_000, []testIO{{testWatched, 10_000_000}}, []testIO{{testSegwit, 3_000_000}, {testWatched, 6_999_000}})
+	coSpend := testTx("co", 1_700_003_600, []testIO{{testWatched, 6_999_000}, {testSegwit, 3_000_000}}, []testIO{{testSegwit, 9_998_000}})
+	back := testTx("back", 1_700_007_200, []testIO{{testSegwit, 9_998_000}}, []testIO{{testWatched, 1_000_000}, {testSegwit, 8_997_000}})
+
+	a := newWalletProfile(testWatched, []Transaction{payment, coSpend, back})
+	b := newWalletProfile(testSegwit, []Transaction{payment, coSpend, back})
+
+	tests := []struct {
+		from, to *walletProfile
+		want     string
+	}{
+		{a, b, "[pay:3000000]"},
+		{b, a, "[back:1000000]"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, transfer := range directTransfers(tt.from, tt.to) {
+			got = append(got, fmt.Sprintf("%s:%d", transfer.TxID, transfer.Amount))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s -> %s: %v, want %s", tt.from.Address, tt.to.Address, got, tt.want)
+		}
+	}
+
+	if txids := coSpends(a, b); fmt.Sprint(txids) != "[co]" {
+		t.Errorf("co-spends %v, want [co]", txids)
+	}
+}
+
+func TestNewWalletProfile(t *testing.T) {
+	p := newWalletProfile(testWatched, []Transaction{
+		testTx("in", 1_700_000_000, []testIO{{testLegacy, 5_001_000}}, []testIO{{testWatched, 5_000_000}}),
+		testTx("out", 1_700_090_000, []testIO{{testWatched, 5_000_000}}, []testIO{{testScript, 2_000_000}, {testWatched, 2_999_000}}),
+	})
+	if p.Received != 5_000_000 || p.Sent != 2_001_000 {
+		t.Errorf("received %d, sent %d, want 5000000 and 2001000", p.Received, p.Sent)
+	}
+	if len(p.Counterparties) != 2 || !p.Counterparties[testLegacy] || !p.Counterparties[testScript] {
+		t.Errorf("counterparties %v, want the sender and the payee", p.Counterparties)
+	}
+	if len(p.ActiveDays) != 2 || !p.First.Before(p.Last) {
+		t.Errorf("%d active days from %s to %s, want 2", len(p.ActiveDays), p.First, p.Last)
+	}
+}
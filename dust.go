@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"crypto_tracker/analysis"
+)
+
+const (
+	DUST_ATTACK_MAX  = 1000 // sats, incoming outputs this small are treated as dust
+	LOOKALIKE_PREFIX = 4    // matching characters after the address prefix
+	LOOKALIKE_SUFFIX = 4
+)
+
+// Unsolicited tiny payment to the watched address. Poisoning when the
+// sender looks like one of the wallet's real counterparties
+type DustEvent struct {
+	TxID      string
+	Vout      int
+	Value     int64
+	Senders   []string
+	Outputs   int    // outputs of the tx, dust campaigns pay many addresses at once
+	Lookalike string // real counterparty the sender imitates, poisoning only
+	Sender    string // sender address that imitates it
+	SpentWith int    // other inputs it was later spent together with, -1 if unspent
+	SpendTxID string
+}
+
+func (e DustEvent) Poisoning() bool {
+	return e.Lookalike != ""
+}
+
+func (e DustEvent) Flag() string {
+	if e.Poisoning() {
+		return "POISON"
+	}
+	return "DUST"
+}
+
+// Part of the address that users actually compare: bech32 addresses lose
+// "bc1q"/"bc1p" and friends, base58 addresses their version character
+func addressBody(addr string) string {
+	lower := strings.ToLower(addr)
+	if i := strings.LastIndex(lower, "1"); i > 0 && (strings.HasPrefix(lower, "bc1") || strings.HasPrefix(lower, "tb1") || strings.HasPrefix(lower, "bcrt1")) {
+		if len(lower) > i+2 {
+			return lower[i+2:]
+		}
+		return ""
+	}
+	if len(addr) > 1 {
+		return addr[1:]
+	}
+	return addr
+}
+
+// Different addresses that share the start and the end a user glances at
+func looksAlike(a, b string) bool {
+	if a == b {
+		return false
+	}
+	bodyA, bodyB := addressBody(a), addressBody(b)
+	if len(bodyA) < LOOKALIKE_PREFIX+LOOKALIKE_SUFFIX || len(bodyB) < LOOKALIKE_PREFIX+LOOKALIKE_SUFFIX {
+		return false
+	}
+	return bodyA[:LOOKALIKE_PREFIX] == bodyB[:LOOKALIKE_PREFIX] &&
+		bodyA[len(bodyA)-LOOKALIKE_SUFFIX:] == bodyB[len(bodyB)-LOOKALIKE_SUFFIX:]
+}
+
+// Finds dust sent to the address in the fetched history and whether the
+// wallet later spent it together with other coins
+func detectDust(transactions []Transaction, address string) []DustEvent {
+	// Counterparties from real payments, the ones worth imitating
+	realCounterparties := make(map[string]bool)
+	for _, tx := range transactions {
+		if paidByWallet(tx, address) {
+			payees, _ := paymentOutputs(detectChange(tx, address))
+			for _, payee := range payees {
+				realCounterparties[payee] = true
+			}
+			continue
+		}
+		if netAmount(address, tx) > DUST_ATTACK_MAX {
+			for _, in := range tx.Inputs {
+				if in.PrevOut.Addr != "" {
+					realCounterparties[in.PrevOut.Addr] = true
+				}
+			}
+		}
+	}
+	var known []string
+	for addr := range realCounterparties {
+		known = append(known, addr)
+	}
+	sort.Strings(known)
+
+	spentIn := make(map[string]Transaction)
+	for _, tx := range transactions {
+		for _, in := range tx.Inputs {
+			spentIn[in.Outpoint()] = tx
+		}
+	}
+
+	var events []DustEvent
+	for _, tx := range transactions {
+		if paidByWallet(tx, address) {
+			continue
+		}
+		for _, out := range tx.Out {
+			if out.Addr != address || out.Value > DUST_ATTACK_MAX {
+				continue
+			}
+			event := DustEvent{TxID: tx.TxID, Vout: out.N, Value: out.Value, Outputs: len(tx.Out), SpentWith: -1}
+			for _, in := range tx.Inputs {
+				if in.PrevOut.Addr == "" {
+					continue
+				}
+				event.Senders = append(event.Senders, in.PrevOut.Addr)
+				for _, real := range known {
+					if event.Lookalike == "" && looksAlike(in.PrevOut.Addr, real) {
+						event.Lookalike, event.Sender = real, in.PrevOut.Addr
+					}
+				}
+			}
+			if spend, ok := spentIn[tx.Outpoint(out.N)]; ok {
+				event.SpentWith = len(spend.Inputs) - 1
+				event.SpendTxID = spend.TxID
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func dustEventsByTx(events []DustEvent) map[string][]DustEvent {
+	byTx := make(map[string][]DustEvent)
+	for _, event := range events {
+		byTx[event.TxID] = append(byTx[event.TxID], event)
+	}
+	return byTx
+}
+
+func analyzeDust(transactions []Transaction, address string) ([]analysis.Finding, Metrics) {
+	var findings []analysis.Finding
+	events := detectDust(transactions, address)
+	metrics := Metrics{"dust_attacks": float64(len(events)), "dust_spent_linked": 0, "poisoning_attempts": 0}
+
+	fmt.Printf("\n%s=== Dust and Address Poisoning ===%s\n\n", Yellow, Reset)
+	if len(events) == 0 {
+		fmt.Printf("- No incoming outputs of %d sats or less\n", DUST_ATTACK_MAX)
+		return nil, metrics
+	}
+
+	for _, event := range events {
+		fmt.Printf("- %s:%d  %d sats from %s (tx has %d outputs)\n",
+			event.TxID, event.Vout, event.Value, formatAddresses(event.Senders, 2), event.Outputs)
+		finding := analysis.Finding{
+			ID: "dust.attack", Severity: analysis.Low, TxIDs: []string{event.TxID},
+			Message: fmt.Sprintf("Unsolicited %d sat output, spending it with other coins links them to the sender", event.Value),
+		}
+
+		if event.Poisoning() {
+			metrics["poisoning_attempts"]++
+			fmt.Printf("  %sAddress poisoning: sender %s imitates your counterparty %s. Check the full address before paying%s\n",
+				Red, event.Sender, labelAddress(event.Lookalike), Reset)
+			finding = analysis.Finding{
+				ID: "dust.poisoning", Severity: analysis.High, TxIDs: []string{event.TxID}, Addresses: []string{event.Sender},
+				Message: fmt.Sprintf("Address poisoning: %s imitates counterparty %s", event.Sender, event.Lookalike),
+			}
+		}
+
+		switch {
+		case event.SpentWith > 0:
+			metrics["dust_spent_linked"]++
+			fmt.Printf("  %sAlready spent together with %d other inputs in %s, those coins are now linked to the sender%s\n",
+				Red, event.SpentWith, event.SpendTxID, Reset)
+			finding.TxIDs = append(finding.TxIDs, event.SpendTxID)
+			if finding.Severity < analysis.Medium {
+				finding.Severity = analysis.Medium
+			}
+		case event.SpentWith == 0:
+			fmt.Printf("  Spent on its own in %s\n", event.SpendTxID)
+		default:
+			fmt.Printf("  %sUnspent: freeze it, or never spend it together with other UTXOs%s\n", Yellow, Reset)
+		}
+		findings = append(findings, finding)
+	}
+	return findings, metrics
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// Share the first and last four characters of the body with each other
+const (
+	testCounterparty = "bc1qabcdxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxwxyz"
+	testImitation    = "bc1qabcdyyyyyyyyyyyyyyyyyyyyyyyyyyyyyywxyz"
+)
+
+func TestAddressBody(t *testing.T) {
+	tests := []struct {
+		addr, body string
+	}{
+		{testCounterparty, "abcdxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxwxyz"},
+		{"BCRT1QABCDWXYZ", "abcdwxyz"},
+		{"tb1pqqqq", "qqqq"},
+		{testLegacy, testLegacy[1:]},
+		{"1", "1"},
+	}
+	for _, tt := range tests {
+		if got := addressBody(tt.addr); got != tt.body {
+			t.Errorf("body of %s: %q, want %q", tt.addr, got, tt.body)
+		}
+	}
+}
+
+func TestLooksAlike(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"bech32 imitation", testCounterparty, testImitation, true},
+		{"witness version ignored", testCounterparty, "bc1pabcdzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzwxyz", true},
+		{"bech32 case ignored", testCounterparty, "BC1QABCDZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZWXYZ", true},
+		{"base58 imitation", "1Abcdxxxxxxxxxxxxxxxxxxxxxxxxxwxyz", "3Abcdyyyyyyyyyyyyyyyyyyyyyyyyywxyz", true},
+		{"base58 case counts", "1Abcdxxxxxxxxxxxxxxxxxxxxxxxxxwxyz", "1abcdyyyyyyyyyyyyyyyyyyyyyyyyywxyz", false},
+		{"same address", testCounterparty, testCounterparty, false},
+		{"only the start matches", testCounterparty, "bc1qabcdyyyyyyyyyyyyyyyyyyyyyyyyyyyyyyvxyz", false},
+		{"only the end matches", testCounterparty, "bc1qzbcdyyyyyyyyyyyyyyyyyyyyyyyyyyyyyywxyz", false},
+		{"too short to compare", "bc1qabcxyz", "bc1qabcxyz0", false},
+	}
+	for _, tt := range tests {
+		if got := looksAlike(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: looks alike %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The wallet pays testCounterparty, then receives dust from its imitation
+// and from testScript, and spends the latter together with other coins
+func testDustHistory() []Transaction {
+	in := testTx("in", 1_700_000_000, []testIO{{testLegacy, 10_001_000}}, []testIO{{testWatched, 10_000_000}})
+	pay := testTx("pay", 1_700_003_600, []testIO{{testWatched, 10_000_000}}, []testIO{{testCounterparty, 1_000_000}, {testWatched, 8_999_000}})
+	testSpend(&pay, 0, in, 0)
+	poison := testTx("poison", 1_700_007_200, []testIO{{testImitation, 10_000}}, []testIO{{testWatched, 546}, {testImitation, 8_454}})
+	dust := testTx("dust", 1_700_010_800, []testIO{{testScript, 10_000}}, []testIO{{testWatched, 500}, {testScript, 8_500}})
+	small := testTx("small", 1_700_014_400, []testIO{{testScript, 10_000}}, []testIO{{testWatched, 5_000}})
+	consolidate := testTx("consolidate", 1_700_018_000, []testIO{{testWatched, 500}, {testWatched, 8_999_000}}, []testIO{{testSegwit, 8_998_500}})
+	testSpend(&consolidate, 0, dust, 0)
+	testSpend(&consolidate, 1, pay, 1)
+	return []Transaction{in, pay, poison, dust, small, consolidate}
+}
+
+func TestDetectDust(t *testing.T) {
+	var got []string
+	for _, e := range detectDust(testDustHistory(), testWatched) {
+		got = append(got, fmt.Sprintf("%s:%d:%d:%s:%d:%s", e.TxID, e.Vout, e.Value, e.Flag(), e.SpentWith, e.SpendTxID))
+		if e.Poisoning() && (e.Lookalike != testCounterparty || e.Sender != testImitation) {
+			t.Errorf("%s: %s imitating %s, want %s imitating %s", e.TxID, e.Sender, e.Lookalike, testImitation, testCounterparty)
+		}
+	}
+	want := "[poison:0:546:POISON:-1: dust:0:500:DUST:1:consolidate]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("events %v, want %s", got, want)
+	}
+}
+
+func TestAnalyzeDust(t *testing.T) {
+	restore := silenceOutput()
+	findings, metrics := analyzeDust(testDustHistory(), testWatched)
+	restore()
+
+	if metrics["dust_attacks"] != 2 || metrics["poisoning_attempts"] != 1 || metrics["dust_spent_linked"] != 1 {
+		t.Errorf("metrics %v, want 2 dust outputs, 1 poisoning, 1 spent with other coins", metrics)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s:%s:%v", f.ID, f.Severity, f.TxIDs))
+	}
+	want := "[dust.poisoning:high:[poison] dust.attack:medium:[dust consolidate]]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("findings %v, want %s", got, want)
+	}
+}
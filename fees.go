@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// mempool.space serves per-block fee stats, Esplora itself doesn't
+var feeStatsURLs = map[Network]string{
+	Mainnet: "https://mempool.space/api",
+	Testnet: "https://mempool.space/testnet/api",
+	Signet:  "https://mempool.space/signet/api",
+}
+
+var (
+	blockFeeCache = make(map[int]float64)
+	blockFeeMutex sync.Mutex
+)
+
+// Median feerate (sat/vB) of the block at the given height
+func getBlockMedianFeeRate(height int) (float64, error) {
+	blockFeeMutex.Lock()
+	defer blockFeeMutex.Unlock()
+
+	if rate, ok := blockFeeCache[height]; ok {
+		return rate, nil
+	}
+
+	baseURL, ok := feeStatsURLs[network]
+	if !ok {
+		return 0, fmt.Errorf("no block fee statistics available on %s", network)
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%s/v1/blocks/%d", baseURL, height))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch block fee stats: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var blocks []struct {
+		Height int `json:"height"`
+		Extras struct {
+			MedianFee float64 `json:"medianFee"`
+		} `json:"extras"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&blocks); err != nil {
+		return 0, fmt.Errorf("failed to parse block fee stats: %v", err)
+	}
+	if len(blocks) == 0 || blocks[0].Height != height {
+		return 0, fmt.Errorf("no fee stats for block %d", height)
+	}
+
+	blockFeeCache[height] = blocks[0].Extras.MedianFee
+	return blocks[0].Extras.MedianFee, nil
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Fee cell for the transaction table
+func formatFee(tx Transaction) string {
+	if tx.VSize() == 0 {
+		return "N/A"
+	}
+	return fmt.Sprintf("%d @ %.1f", tx.Fee, tx.FeeRate())
+}
+
+// Fees only count against the wallet when it funded the tx
+func paidByWallet(tx Transaction, address string) bool {
+	for _, in := range tx.Inputs {
+		if in.PrevOut.Addr == address {
+			return true
+		}
+	}
+	return false
+}
+
+func analyzeFees(transactions []Transaction, address string, txDetails map[string]TransactionDetails) Metrics {
+	const (
+		OUTLIER_HIGH = 3.0 // times the block median
+		OUTLIER_LOW  = 0.5
+	)
+
+	type paidTx struct {
+		tx        Transaction
+		blockRate float64
+		hasMedian bool
+	}
+
+	var (
+		paid         []paidTx
+		totalFees    int64
+		totalFeesUSD float64
+		totalOverpay int64
+		withMedian   int
+		feeRates     []float64
+	)
+
+	for _, tx := range transactions {
+		if !paidByWallet(tx, address) || tx.VSize() == 0 {
+			continue
+		}
+
+		p := paidTx{tx: tx}
+		if !tx.Pending() {
+			if rate, err := getBlockMedianFeeRate(tx.BlockHeight); err == nil && rate > 0 {
+				p.blockRate = rate
+				p.hasMedian = true
+				withMedian++
+			}
+		}
+		paid = append(paid, p)
+
+		totalFees += tx.Fee
+		totalFeesUSD += float64(tx.Fee) / 100_000_000 * txDetails[tx.TxID].Price
+		feeRates = append(feeRates, tx.FeeRate())
+		if p.hasMedian && tx.FeeRate() > p.blockRate {
+			totalOverpay += int64((tx.FeeRate() - p.blockRate) * float64(tx.VSize()))
+		}
+	}
+
+	metrics := Metrics{
+		"fee_outliers":    0,
+		"median_feerate":  median(feeRates),
+		"total_fees_btc":  float64(totalFees) / 100_000_000,
+		"fee_overpay_btc": float64(totalOverpay) / 100_000_000,
+	}
+
+	fmt.Printf("\n%s=== Fee Analysis ===%s\n\n", Yellow, Reset)
+	if len(paid) == 0 {
+		fmt.Printf("- No transactions funded by this wallet\n")
+		return metrics
+	}
+
+	fmt.Printf("- Transactions Paid For: %d\n", len(paid))
+	fmt.Printf("- Total Fees Paid: %.8f BTC", float64(totalFees)/100_000_000)
+	if fiatEnabled() {
+		fmt.Printf(" ($%.2f USD at time of transaction)", totalFeesUSD)
+	}
+	fmt.Printf("\n")
+	fmt.Printf("- Median Feerate: %.1f sat/vB\n", median(feeRates))
+	if withMedian > 0 {
+		fmt.Printf("- Overpaid vs Block Median: %.8f BTC (%d of %d txs with block stats)\n",
+			float64(totalOverpay)/100_000_000, withMedian, len(paid))
+	} else {
+		fmt.Printf("- Overpaid vs Block Median: N/A (no block fee stats on %s)\n", network)
+	}
+
+	// Compare against the block median, or the wallet's own usual
+	// feerate when there are no block stats (pending txs, regtest)
+	walletMedian := median(feeRates)
+	var outliers []string
+	for _, p := range paid {
+		baseline, baselineName := p.blockRate, "the block median"
+		if !p.hasMedian {
+			if len(feeRates) < 3 || walletMedian == 0 {
+				continue
+			}
+			baseline, baselineName = walletMedian, "the wallet's usual"
+		}
+
+		ratio := p.tx.FeeRate() / baseline
+		payees, _ := paymentOutputs(detectChange(p.tx, address))
+		switch {
+		case ratio >= OUTLIER_HIGH:
+			outliers = append(outliers, fmt.Sprintf(
+				"%s to %s paid %.1f sat/vB, %.1fx %s of %.1f (urgent send or different wallet software)",
+				p.tx.TxID, formatAddresses(payees, 1), p.tx.FeeRate(), ratio, baselineName, baseline))
+		case ratio <= OUTLIER_LOW:
+			outliers = append(outliers, fmt.Sprintf(
+				"%s to %s paid %.1f sat/vB, %.1fx %s of %.1f (low or static fee estimation)",
+				p.tx.TxID, formatAddresses(payees, 1), p.tx.FeeRate(), ratio, baselineName, baseline))
+		}
+	}
+
+	if len(outliers) > 0 {
+		fmt.Printf("\n%sFee Outliers:%s\n", Yellow, Reset)
+		for _, outlier := range outliers {
+			fmt.Printf("- %s\n", outlier)
+		}
+	}
+	metrics["fee_outliers"] = float64(len(outliers))
+	return metrics
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		values []float64
+		median float64
+	}{
+		{nil, 0},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); got != tt.median {
+			t.Errorf("median of %v: %v, want %v", tt.values, got, tt.median)
+		}
+	}
+}
+
+func TestFormatFee(t *testing.T) {
+	tx := testTx("a", 0, nil, nil)
+	if got := formatFee(tx); got != "N/A" {
+		t.Errorf("fee without a size: %q, want N/A", got)
+	}
+	tx.Weight = 561 // 141 vbytes
+	if got := formatFee(tx); got != "1000 @ 7.1" {
+		t.Errorf("fee %q, want \"1000 @ 7.1\"", got)
+	}
+}
+
+func TestPaidByWallet(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   Transaction
+		paid bool
+	}{
+		{"spends the wallet", testTx("a", 0, []testIO{{testLegacy, 1}, {testWatched, 1}}, nil), true},
+		{"only pays the wallet", testTx("b", 0, []testIO{{testLegacy, 1}}, []testIO{{testWatched, 1}}), false},
+	}
+	for _, tt := range tests {
+		if got := paidByWallet(tt.tx, testWatched); got != tt.paid {
+			t.Errorf("%s: paid by wallet %v, want %v", tt.name, got, tt.paid)
+		}
+	}
+}
+
+// 100 vbyte txs the wallet paid at the given feerates, plus one it didn't
+func testFeeHistory(rates ...int64) []Transaction {
+	var txs []Transaction
+	for i, rate := range rates {
+		tx := testTx(string(rune('a'+i)), 1_700_000_000+i*600, []testIO{{testWatched, 1_000_000}}, []testIO{{testLegacy, 1_000_000 - rate*100}})
+		tx.Fee, tx.Weight = rate*100, 400
+		txs = append(txs, tx)
+	}
+	incoming := testTx("in", 1_700_000_000, []testIO{{testLegacy, 1_000_000}}, []testIO{{testWatched, 900_000}})
+	incoming.Fee, incoming.Weight = 100_000, 400
+	return append(txs, incoming)
+}
+
+func TestAnalyzeFees(t *testing.T) {
+	savedNetwork := network
+	network = Regtest
+	t.Cleanup(func() { network = savedNetwork })
+
+	tests := []struct {
+		name        string
+		blockMedian float64 // 0 = no block stats, judged against the wallet's own median
+		outliers    float64
+		overpay     float64
+	}{
+		{"against the wallet's usual feerate", 0, 2, 0},
+		{"against the block median", 25, 4, 0.000025},
+	}
+	for _, tt := range tests {
+		blockFeeMutex.Lock()
+		delete(blockFeeCache, 1)
+		if tt.blockMedian > 0 {
+			blockFeeCache[1] = tt.blockMedian
+		}
+		blockFeeMutex.Unlock()
+
+		restore := silenceOutput()
+		metrics := analyzeFees(testFeeHistory(10, 10, 10, 50, 2), testWatched, nil)
+		restore()
+
+		if metrics["fee_outliers"] != tt.outliers {
+			t.Errorf("%s: %v outliers, want %v", tt.name, metrics["fee_outliers"], tt.outliers)
+		}
+		if math.Abs(metrics["fee_overpay_btc"]-tt.overpay) > 1e-12 {
+			t.Errorf("%s: overpaid %v BTC, want %v", tt.name, metrics["fee_overpay_btc"], tt.overpay)
+		}
+		if metrics["median_feerate"] != 10 || math.Abs(metrics["total_fees_btc"]-0.000082) > 1e-12 {
+			t.Errorf("%s: metrics %v, want a 10 sat/vB median and 0.000082 BTC paid", tt.name, metrics)
+		}
+	}
+
+	blockFeeMutex.Lock()
+	delete(blockFeeCache, 1)
+	blockFeeMutex.Unlock()
+}
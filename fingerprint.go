@@ -0,0 +1,269 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	MIN_FINGERPRINT_TXS = 20  // below this the offset guess is noise
+	SLEEP_HOURS         = 6   // shortest daily trough looked for
+	SLEEP_CENTER        = 3   // local hour the trough is assumed to be centred on
+	MAX_TROUGH_SHARE    = 0.1 // trough must hold less than this share of the activity
+	HISTOGRAM_WIDTH     = 30
+)
+
+// When a wallet is used: hour-of-day in UTC and day-of-week in the
+// operator's inferred local time
+type Fingerprint struct {
+	Hours       [24]int
+	Days        [7]int // local time, UTC when the offset is unknown
+	UTCDays     [7]int
+	Total       int
+	Offset      int // inferred UTC offset in hours, valid when OffsetKnown
+	OffsetKnown bool
+	TroughShare float64
+}
+
+func buildFingerprint(transactions []Transaction) Fingerprint {
+	var fp Fingerprint
+	var times []time.Time
+	for _, tx := range transactions {
+		if tx.Time == 0 {
+			continue
+		}
+		t := time.Unix(int64(tx.Time), 0).UTC()
+		times = append(times, t)
+		fp.Hours[t.Hour()]++
+		fp.UTCDays[t.Weekday()]++
+		fp.Total++
+	}
+
+	fp.Offset, fp.TroughShare = inferUTCOffset(fp.Hours)
+	fp.OffsetKnown = fp.Total >= MIN_FINGERPRINT_TXS && fp.TroughShare < MAX_TROUGH_SHARE
+
+	offset := 0
+	if fp.OffsetKnown {
+		offset = fp.Offset
+	}
+	for _, t := range times {
+		fp.Days[t.Add(time.Duration(offset)*time.Hour).Weekday()]++
+	}
+	return fp
+}
+
+// Finds the quietest SLEEP_HOURS window of the day and takes it as the
+// operator's night, centred on SLEEP_CENTER. Ties, common with sparse
+// histories, go to the middle of the longest run of equally quiet windows
+func inferUTCOffset(hours [24]int) (int, float64) {
+	var sums [24]int
+	total := 0
+	for h := 0; h < 24; h++ {
+		total += hours[h]
+		for i := 0; i < SLEEP_HOURS; i++ {
+			sums[h] += hours[(h+i)%24]
+		}
+	}
+	if total == 0 {
+		return 0, 1
+	}
+
+	lowest := sums[0]
+	for _, sum := range sums {
+		lowest = min(lowest, sum)
+	}
+	bestStart, bestLen := 0, 0
+	for h := 0; h < 24; h++ {
+		// Only start counting at the beginning of a run
+		if sums[h] != lowest || sums[(h+23)%24] == lowest {
+			continue
+		}
+		length := 0
+		for length < 24 && sums[(h+length)%24] == lowest {
+			length++
+		}
+		if length > bestLen {
+			bestStart, bestLen = h, length
+		}
+	}
+	if bestLen == 0 {
+		// Flat day, every window is equally quiet
+		return 0, float64(lowest) / float64(total)
+	}
+	// Quiet hours run from the first window's start to the last one's end
+	centre := (bestStart + (bestLen+SLEEP_HOURS-2)/2) % 24
+
+	// local = UTC + offset
+	offset := ((SLEEP_CENTER-centre)%24 + 24) % 24
+	if offset > 12 {
+		offset -= 24
+	}
+	return offset, float64(lowest) / float64(total)
+}
+
+// Activity per weekday divided by activity per weekend day
+func (fp Fingerprint) WeekdayRatio() (float64, bool) {
+	weekend := fp.Days[time.Saturday] + fp.Days[time.Sunday]
+	if weekend == 0 {
+		return 0, false
+	}
+	weekday := fp.Total - weekend
+	return (float64(weekday) / 5) / (float64(weekend) / 2), true
+}
+
+func formatUTCOffset(offset int) string {
+	if offset < 0 {
+		return fmt.Sprintf("UTC-%d", -offset)
+	}
+	return fmt.Sprintf("UTC+%d", offset)
+}
+
+// Cosine similarity of two histograms, 0 when either is empty
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// 0-1 score of how alike two wallets' activity times are. Hours are
+// smoothed with their neighbours so an hour's drift doesn't count as a
+// different habit. Days use UTC for both so the offset guess can't skew it
+func fingerprintSimilarity(a, b Fingerprint) float64 {
+	smooth := func(hours [24]int) []float64 {
+		out := make([]float64, 24)
+		for h := range hours {
+			out[h] = float64(hours[(h+23)%24]) + 2*float64(hours[h]) + float64(hours[(h+1)%24])
+		}
+		return out
+	}
+	days := func(counts [7]int) []float64 {
+		out := make([]float64, 7)
+		for d, count := range counts {
+			out[d] = float64(count)
+		}
+		return out
+	}
+	return 0.7*cosineSimilarity(smooth(a.Hours), smooth(b.Hours)) + 0.3*cosineSimilarity(days(a.UTCDays), days(b.UTCDays))
+}
+
+func histogramBar(count, largest int) string {
+	if largest == 0 {
+		return ""
+	}
+	return strings.Repeat("█", (count*HISTOGRAM_WIDTH+largest-1)/largest)
+}
+
+func printFingerprint(fp Fingerprint) {
+	if fp.Total == 0 {
+		fmt.Printf("- No confirmed transactions\n")
+		return
+	}
+
+	largest, busiest := 0, 0
+	for h, count := range fp.Hours {
+		if count > largest {
+			largest, busiest = count, h
+		}
+	}
+	fmt.Printf("- Most Active Hour: %02d:00 UTC (%d transactions)\n", busiest, largest)
+	if fp.OffsetKnown {
+		fmt.Printf("- Likely Operator Timezone: %s (quietest %d hours hold %.0f%% of activity)\n",
+			formatUTCOffset(fp.Offset), SLEEP_HOURS, fp.TroughShare*100)
+	} else {
+		fmt.Printf("- Likely Operator Timezone: unknown (needs %d+ transactions with a clear daily trough, have %d)\n",
+			MIN_FINGERPRINT_TXS, fp.Total)
+	}
+	if ratio, ok := fp.WeekdayRatio(); ok {
+		fmt.Printf("- Weekday/Weekend Ratio: %.2f (activity per weekday vs per weekend day)\n", ratio)
+	} else {
+		fmt.Printf("- Weekday/Weekend Ratio: no weekend activity\n")
+	}
+
+	fmt.Printf("\nHour of day (UTC):\n")
+	for h, count := range fp.Hours {
+		fmt.Printf("  %02d:00 %4d %s\n", h, count, histogramBar(count, largest))
+	}
+
+	dayLargest := 0
+	for _, count := range fp.Days {
+		dayLargest = max(dayLargest, count)
+	}
+	zone := "UTC"
+	if fp.OffsetKnown {
+		zone = formatUTCOffset(fp.Offset)
+	}
+	fmt.Printf("\nDay of week (%s):\n", zone)
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		fmt.Printf("  %s %4d %s\n", day.String()[:3], fp.Days[day], histogramBar(fp.Days[day], dayLargest))
+	}
+}
+
+// fingerprint -wallet A [-other B]: prints the fingerprint of A and, with
+// -other, how similar B's is
+func runFingerprint(args []string) {
+	fs := flag.NewFlagSet("fingerprint", flag.ExitOnError)
+	address := fs.String("wallet", "", "Bitcoin wallet address to fingerprint")
+	other := fs.String("other", "", "Second wallet to compare the fingerprint with")
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	if *address == "" {
+		log.Fatal("Usage: fingerprint -wallet <address> [-other <address>]")
+	}
+	common.apply()
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if store, err := loadLabels(db); err == nil {
+		labels = store
+	}
+
+	addresses := []string{*address}
+	if *other != "" {
+		addresses = append(addresses, *other)
+	}
+	var fingerprints []Fingerprint
+	for _, addr := range addresses {
+		if _, err := validateAddress(addr, network); err != nil {
+			log.Fatalf("Invalid wallet address: %v", err)
+		}
+		wallet, err := backend.FetchWallet(addr)
+		if err != nil {
+			log.Fatalf("Error fetching wallet: %v", err)
+		}
+		fp := buildFingerprint(wallet.Transactions)
+		fingerprints = append(fingerprints, fp)
+
+		fmt.Printf("\n%s=== Behavioural Fingerprint: %s ===%s\n\n", Yellow, labelAddress(addr), Reset)
+		printFingerprint(fp)
+	}
+
+	if len(fingerprints) == 2 {
+		similarity := fingerprintSimilarity(fingerprints[0], fingerprints[1])
+		fmt.Printf("\n%s=== Fingerprint Similarity ===%s\n\n", Yellow, Reset)
+		fmt.Printf("- Similarity: %.0f%% (hour of day weighted 70%%, day of week 30%%)\n", similarity*100)
+		if fingerprints[0].OffsetKnown && fingerprints[1].OffsetKnown {
+			fmt.Printf("- Timezones: %s vs %s\n", formatUTCOffset(fingerprints[0].Offset), formatUTCOffset(fingerprints[1].Offset))
+		}
+		if min(fingerprints[0].Total, fingerprints[1].Total) < MIN_FINGERPRINT_TXS {
+			fmt.Printf("%s- Fewer than %d transactions in one wallet, treat the score as weak evidence%s\n",
+				Yellow, MIN_FINGERPRINT_TXS, Reset)
+		}
+	}
+}
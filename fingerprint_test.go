@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Activity in every hour except the quiet ones
+func activeExcept(quiet ...int) [24]int {
+	var hours [24]int
+	for h := range hours {
+		hours[h] = 5
+	}
+	for _, h := range quiet {
+		hours[h] = 0
+	}
+	return hours
+}
+
+func TestInferUTCOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		hours  [24]int
+		offset int
+		share  float64
+	}{
+		{"night around midnight UTC", activeExcept(22, 23, 0, 1, 2, 3, 4, 5), 2, 0},
+		{"night in the UTC morning", activeExcept(6, 7, 8, 9, 10, 11, 12, 13), -6, 0},
+		{"night in the UTC afternoon", activeExcept(15, 16, 17, 18, 19, 20, 21, 22), 9, 0},
+		{"flat day", activeExcept(), 0, 0.25},
+		{"no activity", [24]int{}, 0, 1},
+	}
+	for _, tt := range tests {
+		offset, share := inferUTCOffset(tt.hours)
+		if offset != tt.offset || math.Abs(share-tt.share) > 1e-9 {
+			t.Errorf("%s: offset %d share %v, want %d and %v", tt.name, offset, share, tt.offset, tt.share)
+		}
+	}
+}
+
+// Two txs an hour from 08:00 to 21:00 UTC, starting on a Monday
+func testFingerprintHistory() []Transaction {
+	start := time.Date(2023, 11, 6, 0, 0, 0, 0, time.UTC)
+	var txs []Transaction
+	for h := 8; h < 22; h++ {
+		for day := 0; day < 2; day++ {
+			at := start.Add(time.Duration(day*24+h) * time.Hour)
+			txs = append(txs, Transaction{TxID: at.Format(time.RFC3339), Time: int(at.Unix())})
+		}
+	}
+	return txs
+}
+
+func TestBuildFingerprint(t *testing.T) {
+	fp := buildFingerprint(testFingerprintHistory())
+	if fp.Total != 28 || !fp.OffsetKnown || fp.Offset != 1 {
+		t.Errorf("%d txs, offset %d (known %v), want 28 at UTC+1", fp.Total, fp.Offset, fp.OffsetKnown)
+	}
+	// The latest tx each day, 21:00 UTC, is 22:00 local and stays on the same day
+	if fp.Days[time.Monday] != 14 || fp.Days[time.Tuesday] != 14 {
+		t.Errorf("local days %v, want 14 on Monday and Tuesday", fp.Days)
+	}
+
+	short := buildFingerprint(testFingerprintHistory()[:MIN_FINGERPRINT_TXS-1])
+	if short.OffsetKnown {
+		t.Errorf("offset known from %d txs, want at least %d", short.Total, MIN_FINGERPRINT_TXS)
+	}
+}
+
+func TestWeekdayRatio(t *testing.T) {
+	fp := Fingerprint{Total: 12}
+	fp.Days[time.Monday], fp.Days[time.Tuesday], fp.Days[time.Saturday] = 6, 4, 2
+	if ratio, ok := fp.WeekdayRatio(); !ok || math.Abs(ratio-2) > 1e-9 {
+		t.Errorf("ratio %v (%v), want 2 weekday txs per weekend tx", ratio, ok)
+	}
+	if _, ok := (Fingerprint{Total: 3}).WeekdayRatio(); ok {
+		t.Errorf("ratio without weekend activity, want none")
+	}
+}
+
+func TestFormatUTCOffset(t *testing.T) {
+	for offset, want := range map[int]string{0: "UTC+0", 9: "UTC+9", -6: "UTC-6"} {
+		if got := formatUTCOffset(offset); got != want {
+			t.Errorf("%d: %s, want %s", offset, got, want)
+		}
+	}
+}
+
+func TestFingerprintSimilarity(t *testing.T) {
+	a := buildFingerprint(testFingerprintHistory())
+	if got := fingerprintSimilarity(a, a); math.Abs(got-1) > 1e-9 {
+		t.Errorf("same wallet: %v, want 1", got)
+	}
+
+	var b Fingerprint
+	b.Hours[2], b.UTCDays[time.Sunday] = 10, 10
+	if got := fingerprintSimilarity(a, b); got > 0.05 {
+		t.Errorf("night-time weekend wallet: %v, want close to 0", got)
+	}
+	if got := fingerprintSimilarity(a, Fingerprint{}); got != 0 {
+		t.Errorf("empty fingerprint: %v, want 0", got)
+	}
+}
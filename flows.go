@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+// Categories whose flows are findings of their own
+var flowFindingSeverity = map[string]analysis.Severity{
+	"known-scam": analysis.Medium,
+	"mixer":      analysis.Low,
+	"gambling":   analysis.Low,
+}
+
+// Inflow and outflow with one counterparty category, in sats and in USD
+// at the time of each tx
+type CategoryFlow struct {
+	In, Out       int64
+	InUsd, OutUsd float64
+	TxIDs         []string
+	Addresses     map[string]bool
+}
+
+func (f *CategoryFlow) Net() int64 {
+	return f.In - f.Out
+}
+
+func (f *CategoryFlow) add(txid, addr string, sats int64, price float64) {
+	usd := float64(sats) / 100_000_000 * price
+	if sats > 0 {
+		f.In += sats
+		f.InUsd += usd
+	} else {
+		f.Out -= sats
+		f.OutUsd -= usd
+	}
+	if len(f.TxIDs) == 0 || f.TxIDs[len(f.TxIDs)-1] != txid {
+		f.TxIDs = append(f.TxIDs, txid)
+	}
+	f.Addresses[addr] = true
+}
+
+// Category of a counterparty: its label's category, "mixer" for unlabelled
+// CoinJoin participants, "unknown" otherwise
+func counterpartyCategory(addr string, coinjoin bool) string {
+	if label, _, ok := labels.Lookup(addr); ok && label.Category != "" {
+		return label.Category
+	}
+	if coinjoin {
+		return "mixer"
+	}
+	return "unknown"
+}
+
+// Flows per month ("2006-01") and category. Incoming value is split over
+// the senders by the value of their inputs, outgoing value goes to the
+// payees with detected change left out
+func categoryFlows(transactions []Transaction, address string, txDetails map[string]TransactionDetails) map[string]map[string]*CategoryFlow {
+	flows := make(map[string]map[string]*CategoryFlow)
+	add := func(tx Transaction, addr string, sats int64) {
+		// Backends give unconfirmed txs a first-seen time, the block height tells
+		month := "pending"
+		if !tx.Pending() {
+			month = time.Unix(int64(tx.Time), 0).UTC().Format("2006-01")
+		}
+		if flows[month] == nil {
+			flows[month] = make(map[string]*CategoryFlow)
+		}
+		category := counterpartyCategory(addr, detectCoinJoin(tx) != nil)
+		flow, ok := flows[month][category]
+		if !ok {
+			flow = &CategoryFlow{Addresses: make(map[string]bool)}
+			flows[month][category] = flow
+		}
+		flow.add(tx.TxID, addr, sats, txDetails[tx.TxID].Price)
+	}
+
+	for _, tx := range sortedByTime(transactions) {
+		if paidByWallet(tx, address) {
+			for _, role := range detectChange(tx, address) {
+				if !role.Change && role.Addr != "" && role.Addr != address {
+					add(tx, role.Addr, -role.Value)
+				}
+			}
+			continue
+		}
+
+		received := netAmount(address, tx)
+		if received <= 0 {
+			continue
+		}
+		var totalIn int64
+		for _, in := range tx.Inputs {
+			totalIn += in.PrevOut.Value
+		}
+		if totalIn == 0 {
+			continue
+		}
+		// The last input takes the rounding remainder so the split adds up
+		var assigned int64
+		for i, in := range tx.Inputs {
+			share := proportionalShare(received, in.PrevOut.Value, totalIn)
+			if i == len(tx.Inputs)-1 {
+				share = received - assigned
+			}
+			assigned += share
+			if share > 0 {
+				addr := in.PrevOut.Addr
+				if addr == "" {
+					addr = "(unknown sender)"
+				}
+				add(tx, addr, share)
+			}
+		}
+	}
+	return flows
+}
+
+// amount * part / whole in 128 bits, amount * part overflows int64 from
+// about 92 BTC * 1 BTC. Needs 0 <= part <= whole and amount >= 0
+func proportionalShare(amount, part, whole int64) int64 {
+	hi, lo := bits.Mul64(uint64(amount), uint64(part))
+	share, _ := bits.Div64(hi, lo, uint64(whole))
+	return int64(share)
+}
+
+func sortedCategories(byCategory map[string]*CategoryFlow) []string {
+	var categories []string
+	for category := range byCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func printFlowRow(month, category string, f *CategoryFlow) {
+	fmt.Printf("%-8s  %-18s  %14.8f  %14.8f  %15.8f", month, category,
+		float64(f.In)/100_000_000, float64(f.Out)/100_000_000, float64(f.Net())/100_000_000)
+	if fiatEnabled() {
+		fmt.Printf("  %12.2f  %12.2f  %13.2f", f.InUsd, f.OutUsd, f.InUsd-f.OutUsd)
+	}
+	fmt.Println()
+}
+
+// Total in and out per category, zero for the built-in categories
+// without flows so rules on them still apply
+func flowMetrics(totals map[string]*CategoryFlow) Metrics {
+	metrics := make(Metrics)
+	for _, category := range append(labelCategories, "unknown") {
+		metrics[flowMetric(category, "in")] = 0
+		metrics[flowMetric(category, "out")] = 0
+	}
+	for category, f := range totals {
+		metrics[flowMetric(category, "in")] = float64(f.In) / 100_000_000
+		metrics[flowMetric(category, "out")] = float64(f.Out) / 100_000_000
+	}
+	return metrics
+}
+
+func analyzeFlows(transactions []Transaction, address string, txDetails map[string]TransactionDetails) ([]analysis.Finding, Metrics) {
+	flows := categoryFlows(transactions, address, txDetails)
+
+	fmt.Printf("\n%s=== Flows by Counterparty Category ===%s\n\n", Yellow, Reset)
+	if len(flows) == 0 {
+		fmt.Printf("- No counterparty flows\n")
+		return nil, flowMetrics(nil)
+	}
+
+	fmt.Printf("%s%-8s  %-18s  %14s  %14s  %15s", Cyan, "Month", "Category", "In (BTC)", "Out (BTC)", "Net (BTC)")
+	if fiatEnabled() {
+		fmt.Printf("  %12s  %12s  %13s", "In (USD)", "Out (USD)", "Net (USD)")
+	}
+	fmt.Printf("%s\n", Reset)
+
+	var months []string
+	for month := range flows {
+		months = append(months, month)
+	}
+	sort.Strings(months)
+
+	totals := make(map[string]*CategoryFlow)
+	for _, month := range months {
+		for _, category := range sortedCategories(flows[month]) {
+			f := flows[month][category]
+			printFlowRow(month, category, f)
+
+			total, ok := totals[category]
+			if !ok {
+				total = &CategoryFlow{Addresses: make(map[string]bool)}
+				totals[category] = total
+			}
+			total.In += f.In
+			total.Out += f.Out
+			total.InUsd += f.InUsd
+			total.OutUsd += f.OutUsd
+			total.TxIDs = append(total.TxIDs, f.TxIDs...)
+			for addr := range f.Addresses {
+				total.Addresses[addr] = true
+			}
+		}
+	}
+
+	fmt.Printf("\n%sTotals:%s\n", Cyan, Reset)
+	var findings []analysis.Finding
+	for _, category := range sortedCategories(totals) {
+		f := totals[category]
+		printFlowRow("all", category, f)
+		var addrs []string
+		for addr := range f.Addresses {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		fmt.Printf("  %s\n", formatAddresses(addrs, 3))
+
+		severity, ok := flowFindingSeverity[category]
+		if !ok {
+			continue
+		}
+		findings = append(findings, analysis.Finding{
+			ID: "flows." + category, Severity: severity, TxIDs: f.TxIDs, Addresses: addrs,
+			Message: fmt.Sprintf("%.8f BTC in and %.8f BTC out with %s counterparties",
+				float64(f.In)/100_000_000, float64(f.Out)/100_000_000, category),
+		})
+	}
+	if totals["unknown"] != nil {
+		fmt.Printf("\nUnlabelled counterparties are \"unknown\", see \"labels set\" and \"labels import\"\n")
+	}
+	return findings, flowMetrics(totals)
+}
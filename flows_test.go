@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProportionalShare(t *testing.T) {
+	tests := []struct {
+		amount, part, whole, share int64
+	}{
+		{100, 1, 4, 25},
+		{10_000_000_000, 1_000_000_000, 10_500_000_000, 952_380_952},
+		{2_100_000_000_000_000, 2_100_000_000_000_000, 2_100_000_000_000_000, 2_100_000_000_000_000},
+		{5, 0, 7, 0},
+	}
+	for _, tt := range tests {
+		if got := proportionalShare(tt.amount, tt.part, tt.whole); got != tt.share {
+			t.Errorf("%d * %d / %d = %d, want %d", tt.amount, tt.part, tt.whole, got, tt.share)
+		}
+	}
+}
+
+func TestCategoryFlows(t *testing.T) {
+	saved := labels
+	t.Cleanup(func() { labels = saved })
+	labels = &LabelStore{labels: map[string]Label{
+		labelKey("addr", testSegwit): {Type: "addr", Ref: testSegwit, Label: "Exchange", Category: "exchange"},
+		labelKey("addr", testScript): {Type: "addr", Ref: testScript, Label: "Shop", Category: "merchant"},
+	}}
+
+	const nov2023 = 1_700_000_000
+	txs := []Transaction{
+		// 100 BTC in from two senders, 1e10 * 1e9 sats overflows int64
+		testTx("in", nov2023, []testIO{{testSegwit, 1_000_000_000}, {testLegacy, 9_500_000_000}},
+			[]testIO{{testWatched, 10_000_000_000}, {testLegacy, 499_999_000}}),
+		// 0.5 BTC to the shop, change back to the watched address
+		testTx("out", nov2023+3600, []testIO{{testWatched, 10_000_000_000}},
+			[]testIO{{testScript, 50_000_000}, {testWatched, 9_949_999_000}}),
+		// Unconfirmed, first seen in the same month
+		testTx("mempool", nov2023+7200, []testIO{{testSegwit, 20_000_000}}, []testIO{{testWatched, 19_999_000}}),
+	}
+	txs[2].BlockHeight = 0
+	details := map[string]TransactionDetails{"in": {Price: 40_000}, "out": {Price: 40_000}}
+
+	flows := categoryFlows(txs, testWatched, details)
+	month := flows["2023-11"]
+	if month == nil {
+		t.Fatalf("no flows for 2023-11: %v", flows)
+	}
+
+	exchange, unknown := month["exchange"], month["unknown"]
+	if exchange == nil || unknown == nil {
+		t.Fatalf("categories %v, want exchange and unknown", sortedCategories(month))
+	}
+	if exchange.In != 952_380_952 || len(exchange.TxIDs) != 1 {
+		t.Errorf("exchange in %d from %v, want 952380952 from the confirmed tx only", exchange.In, exchange.TxIDs)
+	}
+	if exchange.In+unknown.In != 10_000_000_000 {
+		t.Errorf("inflow split %d + %d, want it to add up to 10000000000", exchange.In, unknown.In)
+	}
+	if math.Abs(exchange.InUsd-float64(exchange.In)/100_000_000*40_000) > 1e-6 {
+		t.Errorf("exchange in %.2f USD, want it at the tx price", exchange.InUsd)
+	}
+
+	merchant := month["merchant"]
+	if merchant == nil || merchant.Out != 50_000_000 || merchant.In != 0 {
+		t.Errorf("merchant flow %+v, want 50000000 out and the change left out", merchant)
+	}
+	if unknown.Out != 0 {
+		t.Errorf("unknown out %d, want 0", unknown.Out)
+	}
+
+	if pending := flows["pending"]; pending == nil || pending["exchange"] == nil || pending["exchange"].In != 19_999_000 {
+		t.Errorf("pending flows %v, want 19999000 in from the exchange", flows["pending"])
+	}
+}
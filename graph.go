@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Address and transaction nodes joined by value-weighted edges: address ->
+// tx for the inputs it spent, tx -> address for the outputs it received
+type GraphNode struct {
+	ID       string
+	Kind     string // address or tx
+	Label    string
+	Category string
+	Time     int64 // tx nodes only
+	Hop      int   // 0 = the watched address, 1 = its own txs and their addresses, ...
+	Flags    []string
+}
+
+type GraphEdge struct {
+	Source string
+	Target string
+	Value  int64 // sats
+	Time   int64
+}
+
+type TxGraph struct {
+	nodes map[string]*GraphNode
+	order []string
+	Edges []GraphEdge
+}
+
+func newTxGraph() *TxGraph {
+	return &TxGraph{nodes: make(map[string]*GraphNode)}
+}
+
+func (g *TxGraph) node(id, kind string, hop int) *GraphNode {
+	if n, ok := g.nodes[id]; ok {
+		return n
+	}
+	n := &GraphNode{ID: id, Kind: kind, Hop: hop}
+	if kind == "address" {
+		if label, _, ok := labels.Lookup(id); ok {
+			n.Label, n.Category = label.Label, label.Category
+		}
+	}
+	g.nodes[id] = n
+	g.order = append(g.order, id)
+	return n
+}
+
+func (g *TxGraph) Nodes() []*GraphNode {
+	nodes := make([]*GraphNode, len(g.order))
+	for i, id := range g.order {
+		nodes[i] = g.nodes[id]
+	}
+	return nodes
+}
+
+// Adds a tx unless it is already in the graph. Several inputs or outputs
+// of one address become a single edge
+func (g *TxGraph) addTx(tx Transaction, hop int) bool {
+	if _, ok := g.nodes[tx.TxID]; ok {
+		return false
+	}
+	txNode := g.node(tx.TxID, "tx", hop)
+	txNode.Time = int64(tx.Time)
+	if match := detectCoinJoin(tx); match != nil {
+		txNode.Flags = append(txNode.Flags, "CJ:"+match.Kind)
+	}
+	if tx.Pending() {
+		txNode.Flags = append(txNode.Flags, "pending")
+	}
+
+	spent := make(map[string]int64)
+	var spenders []string
+	for _, in := range tx.Inputs {
+		if in.PrevOut.Addr == "" {
+			continue
+		}
+		if _, ok := spent[in.PrevOut.Addr]; !ok {
+			spenders = append(spenders, in.PrevOut.Addr)
+		}
+		spent[in.PrevOut.Addr] += in.PrevOut.Value
+	}
+	for _, addr := range spenders {
+		g.node(addr, "address", hop)
+		g.Edges = append(g.Edges, GraphEdge{Source: addr, Target: tx.TxID, Value: spent[addr], Time: int64(tx.Time)})
+	}
+
+	received := make(map[string]int64)
+	var receivers []string
+	for _, out := range tx.Out {
+		if out.Addr == "" {
+			continue
+		}
+		if _, ok := received[out.Addr]; !ok {
+			receivers = append(receivers, out.Addr)
+		}
+		received[out.Addr] += out.Value
+	}
+	for _, addr := range receivers {
+		g.node(addr, "address", hop)
+		g.Edges = append(g.Edges, GraphEdge{Source: tx.TxID, Target: addr, Value: received[addr], Time: int64(tx.Time)})
+	}
+	return true
+}
+
+// Flag a node if it is in the graph, skipping duplicates
+func (g *TxGraph) Flag(id, flag string) {
+	n, ok := g.nodes[id]
+	if !ok {
+		return
+	}
+	for _, f := range n.Flags {
+		if f == flag {
+			return
+		}
+	}
+	n.Flags = append(n.Flags, flag)
+}
+
+// The wallet's own txs are hop 1. Every further hop fetches the history
+// of addresses first seen on the previous one, at most limit fetches in total
+func buildTxGraph(transactions []Transaction, address string, hops, limit int) *TxGraph {
+	g := newTxGraph()
+	g.node(address, "address", 0)
+	g.Flag(address, "watched")
+	for _, tx := range transactions {
+		g.addTx(tx, 1)
+	}
+
+	fetched := map[string]bool{address: true}
+	for hop := 2; hop <= hops; hop++ {
+		var frontier []string
+		for _, n := range g.Nodes() {
+			if n.Kind == "address" && n.Hop == hop-1 && !fetched[n.ID] {
+				frontier = append(frontier, n.ID)
+			}
+		}
+		for _, addr := range frontier {
+			if limit <= 0 {
+				log.Printf("Graph fetch limit reached, hop %d is incomplete", hop)
+				return g
+			}
+			limit--
+			fetched[addr] = true
+			wallet, err := backend.FetchWallet(addr)
+			if err != nil {
+				log.Printf("Error fetching %s for the graph: %v", addr, err)
+				continue
+			}
+			for _, tx := range wallet.Transactions {
+				g.addTx(tx, hop)
+			}
+		}
+	}
+	return g
+}
+
+// Format from -graph-format, or the file extension when it is empty
+func graphFormat(path, format string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".dot", ".gv":
+			format = "dot"
+		case ".json", ".cyjs":
+			format = "json"
+		default:
+			format = "graphml"
+		}
+	}
+	switch format {
+	case "graphml", "dot", "json":
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown graph format %q (graphml, dot or json)", format)
+}
+
+func exportGraph(g *TxGraph, path, format string) error {
+	format, err := graphFormat(path, format)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create graph file: %v", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "dot":
+		err = writeDOT(file, g)
+	case "json":
+		err = writeCytoscapeJSON(file, g)
+	default:
+		err = writeGraphML(file, g)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write graph: %v", err)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func writeGraphML(w io.Writer, g *TxGraph) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, key := range []struct{ id, target, name, typ string }{
+		{"kind", "node", "kind", "string"},
+		{"label", "node", "label", "string"},
+		{"category", "node", "category", "string"},
+		{"flags", "node", "flags", "string"},
+		{"hop", "node", "hop", "int"},
+		{"ntime", "node", "time", "long"},
+		{"value", "edge", "value", "long"},
+		{"btc", "edge", "btc", "double"},
+		{"etime", "edge", "time", "long"},
+	} {
+		fmt.Fprintf(&b, `  <key id="%s" for="%s" attr.name="%s" attr.type="%s"/>`+"\n", key.id, key.target, key.name, key.typ)
+	}
+	b.WriteString(`  <graph id="transactions" edgedefault="directed">` + "\n")
+
+	data := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, `      <data key="%s">%s</data>`+"\n", key, xmlEscape(value))
+		}
+	}
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(&b, `    <node id="%s">`+"\n", xmlEscape(n.ID))
+		data("kind", n.Kind)
+		data("label", n.Label)
+		data("category", n.Category)
+		data("flags", strings.Join(n.Flags, ";"))
+		data("hop", strconv.Itoa(n.Hop))
+		if n.Time > 0 {
+			data("ntime", strconv.FormatInt(n.Time, 10))
+		}
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, `    <edge id="e%d" source="%s" target="%s">`+"\n", i, xmlEscape(e.Source), xmlEscape(e.Target))
+		data("value", strconv.FormatInt(e.Value, 10))
+		data("btc", strconv.FormatFloat(float64(e.Value)/100_000_000, 'f', 8, 64))
+		if e.Time > 0 {
+			data("etime", strconv.FormatInt(e.Time, 10))
+		}
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeDOT(w io.Writer, g *TxGraph) error {
+	var b strings.Builder
+	b.WriteString("digraph transactions {\n  rankdir=LR;\n  node [fontsize=10];\n")
+	for _, n := range g.Nodes() {
+		attrs := []string{"shape=ellipse"}
+		text := n.ID
+		if n.Kind == "tx" {
+			attrs[0] = "shape=box"
+			text = n.ID[:min(16, len(n.ID))]
+		}
+		if n.Label != "" {
+			text += "\n" + n.Label
+		}
+		if len(n.Flags) > 0 {
+			text += "\n[" + strings.Join(n.Flags, ", ") + "]"
+		}
+		attrs = append(attrs, "label="+strconv.Quote(text))
+		switch {
+		case containsFlag(n.Flags, "watched"):
+			attrs = append(attrs, "style=filled", `fillcolor="lightblue"`)
+		case len(n.Flags) > 0 && n.Kind == "address":
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", strconv.Quote(n.ID), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		btc := float64(e.Value) / 100_000_000
+		// Width grows with the log of the value so large flows stand out without swamping the rest
+		width := 1 + math.Log10(1+float64(e.Value)/100_000)
+		fmt.Fprintf(&b, "  %s -> %s [label=\"%.8f\", weight=%d, penwidth=%.2f];\n",
+			strconv.Quote(e.Source), strconv.Quote(e.Target), btc, max(1, e.Value/100_000), width)
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func containsFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Cytoscape.js elements format, also read by Cytoscape desktop
+func writeCytoscapeJSON(w io.Writer, g *TxGraph) error {
+	type element struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	var nodes, edges []element
+	for _, n := range g.Nodes() {
+		data := map[string]interface{}{"id": n.ID, "kind": n.Kind, "hop": n.Hop}
+		if n.Label != "" {
+			data["label"] = n.Label
+		}
+		if n.Category != "" {
+			data["category"] = n.Category
+		}
+		if len(n.Flags) > 0 {
+			data["flags"] = n.Flags
+		}
+		if n.Time > 0 {
+			data["time"] = n.Time
+		}
+		nodes = append(nodes, element{Data: data})
+	}
+	for i, e := range g.Edges {
+		data := map[string]interface{}{
+			"id": fmt.Sprintf("e%d", i), "source": e.Source, "target": e.Target,
+			"value": e.Value, "btc": float64(e.Value) / 100_000_000,
+		}
+		if e.Time > 0 {
+			data["time"] = e.Time
+		}
+		edges = append(edges, element{Data: data})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"elements": map[string][]element{"nodes": nodes, "edges": edges},
+	})
+}
+
+// Flags the graph with what the run found, then writes it
+func exportRunGraph(path, format string, transactions []Transaction, address string, hops, limit int, txDetails map[string]TransactionDetails) {
+	g := buildTxGraph(transactions, address, hops, limit)
+	for _, flag := range Suspiciouswallets {
+		g.Flag(flag.Address, flag.Reason)
+	}
+	for txid, details := range txDetails {
+		for _, flag := range details.Flags {
+			g.Flag(txid, flag)
+		}
+	}
+
+	// Keep the output stable between runs
+	sort.SliceStable(g.Edges, func(i, j int) bool { return g.Edges[i].Time < g.Edges[j].Time })
+	if err := exportGraph(g, path, format); err != nil {
+		log.Printf("Error exporting graph: %v", err)
+		return
+	}
+	fmt.Printf("\n%sTransaction graph written to %s (%d nodes, %d edges)%s\n", Yellow, path, len(g.order), len(g.Edges), Reset)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGraphFormat(t *testing.T) {
+	tests := []struct {
+		path, format, want string
+		err                bool
+	}{
+		{path: "g.graphml", want: "graphml"},
+		{path: "g.DOT", want: "dot"},
+		{path: "g.gv", want: "dot"},
+		{path: "g.cyjs", want: "json"},
+		{path: "g.txt", want: "graphml"},
+		{path: "g.dot", format: "json", want: "json"},
+		{path: "g.dot", format: "gexf", err: true},
+	}
+	for _, tt := range tests {
+		got, err := graphFormat(tt.path, tt.format)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%s %q: %q (%v), want %q", tt.path, tt.format, got, err, tt.want)
+		}
+	}
+}
+
+// The wallet pays a labelled shop from two inputs, with change back
+func testGraph(t *testing.T) *TxGraph {
+	saved := labels
+	t.Cleanup(func() { labels = saved })
+	labels = &LabelStore{labels: map[string]Label{
+		labelKey("addr", testSegwit): {Type: "addr", Ref: testSegwit, Label: `Shop "A&B" <x>`, Category: "merchant"},
+	}}
+
+	pay := testTx("pay", 1_700_000_000, []testIO{{testWatched, 100_000}, {testWatched, 200_000}}, []testIO{{testSegwit, 250_000}, {testWatched, 49_000}})
+	pending := testTx("pending", 1_700_003_600, []testIO{{testLegacy, 10_000}}, []testIO{{testWatched, 9_000}})
+	pending.BlockHeight = 0
+	return buildTxGraph([]Transaction{pay, pending, pay}, testWatched, 1, 0)
+}
+
+func TestTxGraphAddTx(t *testing.T) {
+	g := testGraph(t)
+
+	var nodes []string
+	for _, n := range g.Nodes() {
+		nodes = append(nodes, fmt.Sprintf("%s:%d:%v", n.Kind, n.Hop, n.Flags))
+	}
+	want := "[address:0:[watched] tx:1:[] address:1:[] tx:1:[pending] address:1:[]]"
+	if fmt.Sprint(nodes) != want {
+		t.Errorf("nodes %v, want %s", nodes, want)
+	}
+	if n := g.nodes[testSegwit]; n.Label != `Shop "A&B" <x>` || n.Category != "merchant" {
+		t.Errorf("shop node %+v, want its label", n)
+	}
+
+	names := map[string]string{testWatched: "watched", testSegwit: "shop", testLegacy: "sender"}
+	name := func(id string) string {
+		if n, ok := names[id]; ok {
+			return n
+		}
+		return id
+	}
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, fmt.Sprintf("%s>%s:%d", name(e.Source), name(e.Target), e.Value))
+	}
+	// The two inputs of the watched address are one edge, the repeated tx is skipped
+	want = "[watched>pay:300000 pay>shop:250000 pay>watched:49000 sender>pending:10000 pending>watched:9000]"
+	if fmt.Sprint(edges) != want {
+		t.Errorf("edges %v, want %s", edges, want)
+	}
+}
+
+func TestBuildTxGraphHops(t *testing.T) {
+	in := testTx("in", 0, []testIO{{testLegacy, 10_000}}, []testIO{{testWatched, 9_000}})
+	test := &testBackend{wallets: map[string][]Transaction{
+		testLegacy:  {in, testTx("far", 0, []testIO{{testTaproot, 20_000}}, []testIO{{testLegacy, 19_000}})},
+		testTaproot: {testTx("further", 0, []testIO{{testScript, 30_000}}, []testIO{{testTaproot, 29_000}})},
+	}}
+	saved := backend
+	backend = test
+	t.Cleanup(func() { backend = saved })
+
+	tests := []struct {
+		hops, limit int
+		txs         string
+	}{
+		{1, 10, "[in]"},
+		{2, 10, "[in far]"},
+		{3, 10, "[in far further]"},
+		{3, 1, "[in far]"},
+	}
+	for _, tt := range tests {
+		restore := silenceOutput()
+		g := buildTxGraph([]Transaction{in}, testWatched, tt.hops, tt.limit)
+		restore()
+		var txs []string
+		for _, n := range g.Nodes() {
+			if n.Kind == "tx" {
+				txs = append(txs, n.ID)
+			}
+		}
+		if fmt.Sprint(txs) != tt.txs {
+			t.Errorf("%d hops, limit %d: txs %v, want %s", tt.hops, tt.limit, txs, tt.txs)
+		}
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGraphML(&buf, testGraph(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+	var doc struct {
+		Keys []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"key"`
+		Nodes []struct {
+			ID   string `xml:"id,attr"`
+			Data []data `xml:"data"`
+		} `xml:"graph>node"`
+		Edges []struct {
+			Source string `xml:"source,attr"`
+			Target string `xml:"target,attr"`
+			Data   []data `xml:"data"`
+		} `xml:"graph>edge"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GraphML: %v\n%s", err, buf.String())
+	}
+	if len(doc.Keys) != 9 || len(doc.Nodes) != 5 || len(doc.Edges) != 5 {
+		t.Fatalf("%d keys, %d nodes, %d edges, want 9, 5 and 5", len(doc.Keys), len(doc.Nodes), len(doc.Edges))
+	}
+
+	found := false
+	for _, n := range doc.Nodes {
+		for _, d := range n.Data {
+			if d.Key == "label" {
+				found = n.ID == testSegwit && d.Value == `Shop "A&B" <x>`
+			}
+		}
+	}
+	if !found {
+		t.Errorf("shop label lost in the escaping:\n%s", buf.String())
+	}
+	if e := doc.Edges[1]; e.Source != "pay" || e.Target != testSegwit || fmt.Sprint(e.Data) != "[{value 250000} {btc 0.00250000} {etime 1700000000}]" {
+		t.Errorf("edge %+v, want the payment to the shop", e)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDOT(&buf, testGraph(t)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`"` + testWatched + `" [shape=ellipse, label="` + testWatched + `\n[watched]", style=filled, fillcolor="lightblue"];`,
+		`"pay" [shape=box, label="pay"];`,
+		`"` + testSegwit + `" [shape=ellipse, label="` + testSegwit + `\nShop \"A&B\" <x>"];`,
+		`"pending" [shape=box, label="pending\n[pending]"];`,
+		`"pay" -> "` + testSegwit + `" [label="0.00250000", weight=2, penwidth=1.54];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in:\n%s", want, out)
+		}
+	}
+	if !strings.HasPrefix(out, "digraph transactions {") || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("not a digraph:\n%s", out)
+	}
+}
+
+func TestWriteCytoscapeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeCytoscapeJSON(&buf, testGraph(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	type element struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	var doc struct {
+		Elements struct {
+			Nodes []element `json:"nodes"`
+			Edges []element `json:"edges"`
+		} `json:"elements"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(doc.Elements.Nodes) != 5 || len(doc.Elements.Edges) != 5 {
+		t.Fatalf("%d nodes and %d edges, want 5 and 5", len(doc.Elements.Nodes), len(doc.Elements.Edges))
+	}
+	if shop := doc.Elements.Nodes[2].Data; shop["id"] != testSegwit || shop["category"] != "merchant" || shop["flags"] != nil {
+		t.Errorf("shop node %v, want its category and no flags", shop)
+	}
+	if edge := doc.Elements.Edges[1].Data; edge["id"] != "e1" || edge["value"] != 250_000.0 || edge["btc"] != 0.0025 {
+		t.Errorf("edge %v, want the 250000 sat payment", edge)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Label categories used by the reports. Anything else is accepted too
+var labelCategories = []string{"exchange", "merchant", "our-cold-storage", "known-scam", "mixer", "gambling", "personal"}
+
+// One BIP-329 record. Category isn't part of BIP-329, it is exported as
+// an extra field which other wallets ignore
+type Label struct {
+	Type      string `json:"type"`
+	Ref       string `json:"ref"`
+	Label     string `json:"label"`
+	Origin    string `json:"origin,omitempty"`
+	Spendable *bool  `json:"spendable,omitempty"`
+	Category  string `json:"category,omitempty"`
+}
+
+type LabelStore struct {
+	labels   map[string]Label // keyed by type + ":" + ref
+	clusters *Clusters        // address labels also cover the rest of their cluster
+}
+
+// Labels shown next to addresses in the reports, loaded in main
+var labels = &LabelStore{labels: make(map[string]Label)}
+
+func labelKey(typ, ref string) string {
+	return typ + ":" + ref
+}
+
+func initLabelTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS labels (
+            type      TEXT NOT NULL,
+            ref       TEXT NOT NULL,
+            label     TEXT NOT NULL,
+            category  TEXT NOT NULL DEFAULT '',
+            origin    TEXT NOT NULL DEFAULT '',
+            spendable INTEGER,
+            PRIMARY KEY (type, ref)
+        )`)
+	return err
+}
+
+func loadLabels(db *sql.DB) (*LabelStore, error) {
+	if err := initLabelTable(db); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT type, ref, label, category, origin, spendable FROM labels`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	store := &LabelStore{labels: make(map[string]Label)}
+	for rows.Next() {
+		var l Label
+		var spendable sql.NullBool
+		if err := rows.Scan(&l.Type, &l.Ref, &l.Label, &l.Category, &l.Origin, &spendable); err != nil {
+			return nil, err
+		}
+		if spendable.Valid {
+			l.Spendable = &spendable.Bool
+		}
+		store.labels[labelKey(l.Type, l.Ref)] = l
+	}
+	return store, rows.Err()
+}
+
+func saveLabel(db *sql.DB, l Label) error {
+	var spendable interface{}
+	if l.Spendable != nil {
+		spendable = *l.Spendable
+	}
+	_, err := db.Exec(`INSERT OR REPLACE INTO labels (type, ref, label, category, origin, spendable) VALUES (?, ?, ?, ?, ?, ?)`,
+		l.Type, l.Ref, l.Label, l.Category, l.Origin, spendable)
+	return err
+}
+
+// Label of an address, falling back to a labelled address in the same
+// cluster. direct is false when the label came from the cluster
+func (s *LabelStore) Lookup(addr string) (label Label, direct bool, ok bool) {
+	if l, ok := s.labels[labelKey("addr", addr)]; ok {
+		return l, true, true
+	}
+	// Find adds unknown addresses, a lookup mustn't change the clusters
+	if s.clusters == nil || addr == "" || s.clusters.parent[addr] == "" {
+		return Label{}, false, false
+	}
+	// Lowest ref wins so the pick is stable between runs
+	root := s.clusters.Find(addr)
+	for _, l := range s.labels {
+		if l.Type != "addr" || s.clusters.parent[l.Ref] == "" || s.clusters.Find(l.Ref) != root {
+			continue
+		}
+		if !ok || l.Ref < label.Ref {
+			label, ok = l, true
+		}
+	}
+	return label, false, ok
+}
+
+// "addr [name, category]", or just the address when it has no label
+func labelAddress(addr string) string {
+	l, direct, ok := labels.Lookup(addr)
+	if !ok {
+		return addr
+	}
+	tag := l.Label
+	if l.Category != "" {
+		tag += ", " + l.Category
+	}
+	if !direct {
+		tag += ", via cluster"
+	}
+	return fmt.Sprintf("%s [%s]", addr, tag)
+}
+
+func parseLabelsJSONL(r io.Reader) ([]Label, error) {
+	var result []Label
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var l Label
+		if err := json.Unmarshal([]byte(text), &l); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %v", line, err)
+		}
+		if l.Type == "" || l.Ref == "" {
+			return nil, fmt.Errorf("line %d is missing type or ref", line)
+		}
+		result = append(result, l)
+	}
+	return result, scanner.Err()
+}
+
+func writeLabelsJSONL(w io.Writer, store *LabelStore) error {
+	var keys []string
+	for key := range store.labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoder := json.NewEncoder(w)
+	for _, key := range keys {
+		if err := encoder.Encode(store.labels[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runLabels(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: labels set|delete|list|import|export ...")
+	}
+
+	fs := flag.NewFlagSet("labels "+args[0], flag.ExitOnError)
+	address := fs.String("address", "", "Address to label")
+	name := fs.String("name", "", "Human readable name")
+	category := fs.String("category", "", "Category: "+strings.Join(labelCategories, ", ")+" or your own")
+	path := fs.String("file", "", "BIP-329 JSONL file for import/export (export defaults to stdout)")
+	fs.Parse(args[1:])
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	store, err := loadLabels(db)
+	if err != nil {
+		log.Fatalf("Error loading labels: %v", err)
+	}
+
+	switch args[0] {
+	case "set":
+		if *address == "" || *name == "" {
+			log.Fatal("Usage: labels set -address <address> -name <name> [-category <category>]")
+		}
+		if _, err := decodeAddress(*address); err != nil {
+			log.Fatalf("Invalid address: %v", err)
+		}
+		if err := saveLabel(db, Label{Type: "addr", Ref: *address, Label: *name, Category: *category}); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Labelled %s as %s\n", *address, *name)
+
+	case "delete":
+		if _, err := db.Exec(`DELETE FROM labels WHERE type = 'addr' AND ref = ?`, *address); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed label of %s\n", *address)
+
+	case "list":
+		var keys []string
+		for key := range store.labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			l := store.labels[key]
+			line := fmt.Sprintf("- %s %s: %s", l.Type, l.Ref, l.Label)
+			if l.Category != "" {
+				line += fmt.Sprintf(" (%s)", l.Category)
+			}
+			fmt.Println(line)
+		}
+		if len(keys) == 0 {
+			fmt.Println("No labels stored")
+		}
+
+	case "import":
+		if *path == "" {
+			log.Fatal("Usage: labels import -file <labels.jsonl>")
+		}
+		file, err := os.Open(*path)
+		if err != nil {
+			log.Fatalf("Error opening %s: %v", *path, err)
+		}
+		defer file.Close()
+		imported, err := parseLabelsJSONL(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range imported {
+			if err := saveLabel(db, l); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("Imported %d labels\n", len(imported))
+
+	case "export":
+		out := os.Stdout
+		if *path != "" {
+			file, err := os.Create(*path)
+			if err != nil {
+				log.Fatalf("Error creating %s: %v", *path, err)
+			}
+			defer file.Close()
+			out = file
+		}
+		if err := writeLabelsJSONL(out, store); err != nil {
+			log.Fatal(err)
+		}
+		if *path != "" {
+			fmt.Printf("Exported %d labels to %s\n", len(store.labels), *path)
+		}
+
+	default:
+		log.Fatalf("Unknown labels command %q", args[0])
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// BIP-329 records of every type, with the optional fields set and unset
+const testLabelsJSONL = `{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"Transaction","origin":"wpkh([d34db33f/84'/0'/0'])"}
+{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address"}
+{"type":"pubkey","ref":"0283409659355b6d1cc3c32decd5d561abaac86c37a353b52895a5e6c196d6f448","label":"Public Key"}
+{"type":"input","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:0","label":"Input"}
+{"type":"output","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:1","label":"Output","spendable":false}
+{"type":"xpub","ref":"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8","label":"Extended Public Key"}
+
+{"type":"addr","ref":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2","label":"Hot wallet","category":"exchange","spendable":true}
+`
+
+func TestLabelsRoundTrip(t *testing.T) {
+	parsed, err := parseLabelsJSONL(strings.NewReader(testLabelsJSONL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 7 {
+		t.Fatalf("parsed %d labels, want 7", len(parsed))
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	if err := initLabelTable(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range parsed {
+		if err := saveLabel(db, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := loadLabels(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	if err := writeLabelsJSONL(&exported, store); err != nil {
+		t.Fatal(err)
+	}
+	reparsed, err := parseLabelsJSONL(&exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byKey := make(map[string]Label)
+	for _, l := range reparsed {
+		byKey[labelKey(l.Type, l.Ref)] = l
+	}
+	if len(byKey) != len(parsed) {
+		t.Errorf("exported %d labels, want %d", len(byKey), len(parsed))
+	}
+	for _, want := range parsed {
+		if got := byKey[labelKey(want.Type, want.Ref)]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s %s: round trip gave %+v, want %+v", want.Type, want.Ref, got, want)
+		}
+	}
+}
+
+func TestParseLabelsJSONLInvalid(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`{"type":"addr","ref":"x","label":"ok"}` + "\n{not json}\n", "line 2"},
+		{`{"ref":"x","label":"no type"}`, "missing type or ref"},
+		{`{"type":"addr","label":"no ref"}`, "missing type or ref"},
+	}
+	for _, tt := range tests {
+		_, err := parseLabelsJSONL(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want one mentioning %q", tt.input, err, tt.err)
+		}
+	}
+}
+
+func TestLabelLookup(t *testing.T) {
+	clusters := newClusters()
+	clusters.Union("labelled", "linked")
+	clusters.Find("alone")
+	store := &LabelStore{
+		labels:   map[string]Label{labelKey("addr", "labelled"): {Type: "addr", Ref: "labelled", Label: "Exchange"}},
+		clusters: clusters,
+	}
+
+	if l, direct, ok := store.Lookup("labelled"); !ok || !direct || l.Label != "Exchange" {
+		t.Errorf("labelled: %+v direct %v ok %v, want a direct label", l, direct, ok)
+	}
+	if l, direct, ok := store.Lookup("linked"); !ok || direct || l.Ref != "labelled" {
+		t.Errorf("linked: %+v direct %v ok %v, want the label through the cluster", l, direct, ok)
+	}
+	if _, _, ok := store.Lookup("alone"); ok {
+		t.Errorf("alone: got a label from another cluster")
+	}
+
+	before := len(clusters.parent)
+	if _, _, ok := store.Lookup("unknown"); ok {
+		t.Errorf("unknown: got a label")
+	}
+	if len(clusters.parent) != before {
+		t.Errorf("looking up an unknown address grew the clusters from %d to %d addresses", before, len(clusters.parent))
+	}
+}
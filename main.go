@@ -6,18 +6,20 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"sync"
 	"time"
-	"math"
     "io"
 	"strings"
     "database/sql"
-	//"sort"
+	"sort"
     _ "github.com/mattn/go-sqlite3"
+	"crypto_tracker/analysis"
 	
 )
 
-const (
+// Blanked when color is off, see setupColor
+var (
 	Red     = "\033[31m"
 	Green   = "\033[32m"
 	Reset   = "\033[0m"
@@ -28,26 +30,13 @@ const (
 )
 
 
-type Input struct {
-    PrevOut struct {
-        Addr  string `json:"addr"`
-        Value int64  `json:"value"`
-    } `json:"prev_out"`
-}
-
-type Output struct {
-    Addr   string `json:"addr"`
-    Value  int64  `json:"value"`
-    Spent  bool   `json:"spent"`
-}
-type Transaction struct {
-	TxID          string `json:"hash"`
-	Confirmations int    `json:"confirmations"`
-	Time          int    `json:"time"`
-	Inputs        []Input `json:"inputs"` 
-    Out           []Output `json:"out"`
-
-}
+// Shared with analyzer packages, see analysis/
+type (
+	Input              = analysis.Input
+	Output             = analysis.Output
+	Transaction        = analysis.Transaction
+	TransactionDetails = analysis.TransactionDetails
+)
 
 type WalletResponse struct {
 	Address       string        `json:"address"`
@@ -86,24 +75,11 @@ type TransactionAnalysis struct {
 }
 
 
-type TransactionDetails struct {
-	Amount        float64
-	Price         float64
-	Time          time.Time
-	Confirmations int
-	DisplayOrigin    string
-    DisplayDest      string
-	
-}
-
 var client = &http.Client{
 	Timeout: 20 * time.Second,
 }
 
 
-var Suspiciouswallets []string
-
-
 
 //INside a for loop 
 
@@ -186,14 +162,6 @@ func GetPrice(timestamp int64) (*HistoricalPrice , error) {
 
 
 
-func Getsuswallets(){
-
-
-
-}
-
-
-
 //Need to remove this 
 func getMidnightTimestamp(timestamp int64) string {
     t := time.Unix(timestamp, 0).UTC()
@@ -257,315 +225,63 @@ func getTransactionAmount(address, txid string) (*Amount, error) {
 
 
 
-func printTableHeader() {
-    
-    fmt.Printf("\n%s╔══════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════╗%s\n", Headers, Reset)
-    
-   
-    fmt.Printf("%s║ %-20s │ %-15s │ %-12s │ %-15s │ %-20s │ %-35s │ %-35s ║%s\n",
-        Headers,
-        "Transaction ID",
-        "Amount (BTC)",
-        "Confirmations",
-        "USD Value",
-        "Time",
-        "Origin",
-        "Destination",
-        Reset)
-    
-   
-    fmt.Printf("%s╠═════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════╣%s\n", Headers, Reset)
+// Columns of the transaction table, the amount and txid are the last to go
+func newTransactionTable() *Table {
+	address := func(title string) Column {
+		return Column{Title: title, Min: 16, Priority: 7, Abbrev: abbreviateAddress}
+	}
+	return &Table{Columns: []Column{
+		{Title: "Transaction ID", Min: 12, Priority: 9, Abbrev: truncateMiddle},
+		{Title: "Amount (BTC)", Align: AlignRight, Priority: 10},
+		{Title: "Confirmations", Min: 7, Priority: 5},
+		{Title: "USD Value", Align: AlignRight, Priority: 4},
+		{Title: "Fee (sat @ sat/vB)", Min: 10, Priority: 3},
+		{Title: "Time", Min: 10, Priority: 8},
+		address("Origin"),
+		address("Destination"),
+		{Title: "Flags", Min: 6, Priority: 6},
+	}}
 }
 
 
-func printWalletSummary(wallet *WalletResponse, currentPrice float64) {
+func printWalletSummary(wallet *WalletResponse, addrInfo *AddressInfo, currentPrice float64) {
 	balance := float64(wallet.FinalBalance) / 100_000_000
 	bitcoinSent := float64(wallet.TotalSent) / 100_000_000
 	bitcoinReceived := float64(wallet.TotalReceived) / 100_000_000
 
-	fmt.Printf("\n%s╔════════════════ Wallet Summary ════════════════╗%s\n", Headers, Reset)
-	fmt.Printf("%s║ Address: %-37s ║%s\n", Headers, wallet.Address, Reset)
-	fmt.Printf("%s║ Total Received: %-8.8f BTC              ║%s\n", Headers, bitcoinReceived, Reset)
-	fmt.Printf("%s║ Total Sent: %-8.8f BTC                  ║%s\n", Headers, bitcoinSent, Reset)
-	fmt.Printf("%s║ Current Balance: %-8.8f BTC             ║%s\n", Headers, balance, Reset)
-	fmt.Printf("%s║ Current Value: $%-10.2f USD             ║%s\n", Headers, balance*currentPrice, Reset)
-	fmt.Printf("%s║ Total Transactions: %-6d                ║%s\n", Headers, wallet.TxCount, Reset)
-	fmt.Printf("%s╚══════════════════════════════════════════════╝%s\n", Headers, Reset)
-}
-
-
-
-
-
-//FUnc analyse pattern 2222
-
-
-
-
-
-
-
-
-
-//Need to study this              
-func analyzeTransactionPatterns(transactions []Transaction, address string, txDetails map[string]TransactionDetails) {
-    type AddressStats struct {
-        totalTransactions int
-        totalVolume       float64
-        lastSeen          time.Time
-        transactionTypes  map[string]int
-        amounts           []float64
-        timeDiffs         []float64
-        dailyVolume       map[string]float64 
-    }
-
-    addressStats := make(map[string]AddressStats)
-    unusualPatterns := make(map[string][]string)
-
-    const (
-        RAPID_TX_WINDOW          = 24 * time.Hour
-        DORMANCY_PERIOD          = 30 * 24 * time.Hour
-        HIGH_VALUE_THRESHOLD     = 1.0 
-        UNUSUAL_VARIANCE_THRESHOLD = 2.0
-        TEMPORAL_SPAM_THRESHOLD   = 3.0  
-    )
-
-    rapidTransactions := make(map[time.Time][]string)
-    var lastTxTime time.Time
-    var previousAmounts []float64
-
-    fmt.Printf("\n%s=== Security Analysis Report ===%s\n\n", Headers, Reset)
-
-    for _, tx := range transactions {
-        details := txDetails[tx.TxID]
-        txTime := time.Unix(int64(tx.Time), 0)
-
-        for _, input := range tx.Inputs {
-            addr := input.PrevOut.Addr
-            if addr == "" {
-                continue
-            }
-
-            stats := addressStats[addr]
-            stats.totalTransactions++
-            stats.totalVolume += math.Abs(details.Amount)
-            stats.lastSeen = txTime
-            if stats.transactionTypes == nil {
-                stats.transactionTypes = make(map[string]int)
-            }
-            stats.transactionTypes["out"]++
-            stats.amounts = append(stats.amounts, math.Abs(details.Amount))
-
-            if len(stats.amounts) > 1 {
-                timeDiff := txTime.Sub(lastTxTime).Hours()
-                stats.timeDiffs = append(stats.timeDiffs, timeDiff)
-            }
-
-            
-            day := txTime.Format("2006-01-02")
-            if stats.dailyVolume == nil {
-                stats.dailyVolume = make(map[string]float64)
-            }
-            stats.dailyVolume[day] += math.Abs(details.Amount)
-
-            addressStats[addr] = stats
-        }
-
-        for _, output := range tx.Out {
-            addr := output.Addr
-            if addr == "" {
-                continue
-            }
-
-            stats := addressStats[addr]
-            stats.totalTransactions++
-            stats.totalVolume += math.Abs(details.Amount)
-            stats.lastSeen = txTime
-            if stats.transactionTypes == nil {
-                stats.transactionTypes = make(map[string]int)
-            }
-            stats.transactionTypes["in"]++
-            stats.amounts = append(stats.amounts, math.Abs(details.Amount))
-
-            addressStats[addr] = stats
-        }
-
-        if !lastTxTime.IsZero() {
-            timeDiff := txTime.Sub(lastTxTime)
-            if timeDiff < RAPID_TX_WINDOW {
-                rapidTransactions[txTime] = append(rapidTransactions[txTime], tx.TxID)
-            }
-        }
-
-        lastTxTime = txTime
-        previousAmounts = append(previousAmounts, math.Abs(details.Amount))
-    }
-
-    fmt.Printf("%s1. Suspicious Pattern Detection%s\n", Headers, Reset)
-
-    
-    for addr, stats := range addressStats {
-        if addr == address {
-            continue 
-        }
-
-        
-        var mean, variance float64
-        for _, amount := range stats.amounts {
-            mean += amount
-        }
-        mean /= float64(len(stats.amounts))
-
-        for _, amount := range stats.amounts {
-            variance += math.Pow(amount-mean, 2)
-        }
-        variance /= float64(len(stats.amounts))
-        stdDev := math.Sqrt(variance)
-
-       
-        if stdDev > UNUSUAL_VARIANCE_THRESHOLD && stats.totalTransactions > 3 {
-            unusualPatterns[addr] = append(unusualPatterns[addr], 
-                fmt.Sprintf("High variance in transaction amounts (stdDev: %.2f BTC)", stdDev))
-        }
-
-        
-        if stats.totalVolume > HIGH_VALUE_THRESHOLD && stats.totalTransactions < 3 {
-            unusualPatterns[addr] = append(unusualPatterns[addr], 
-                "High volume with few transactions")
-        }
-
-        
-        var avgTimeDiff float64
-
-
-
-        if len(stats.timeDiffs) > 0 {
-            for _, diff := range stats.timeDiffs {
-                avgTimeDiff += diff
-            }
-            avgTimeDiff /= float64(len(stats.timeDiffs))
-
-            if avgTimeDiff < 1.0 && len(stats.timeDiffs) > 3 {
-                unusualPatterns[addr] = append(unusualPatterns[addr], 
-                    "Unusually frequent transactions")
-            
-                }
-        }
-
-        
-        for day, dailyVolume := range stats.dailyVolume {
-            if dailyVolume > HIGH_VALUE_THRESHOLD && len(stats.amounts) > TEMPORAL_SPAM_THRESHOLD {
-                unusualPatterns[addr] = append(unusualPatterns[addr], 
-                    fmt.Sprintf("High volume on %s, possibly suspicious activity", day))
-            }
-        }
-    }
-
-    
-
-    //Get suspicious wallets from here 
-    
-    if len(unusualPatterns) > 0 {
-        fmt.Printf("\n%sDetected Suspicious Patterns:%s\n", Yellow, Reset)
-        for addr, patterns := range unusualPatterns {
-            
-            
-            
-            //Append the suspicious wallets
-           // Suspiciouswallets =append(Suspiciouswallets,addr)
-        
-           
-           
-            fmt.Printf("Address: %s\n", addr)
-            for _, pattern := range patterns {
-                fmt.Printf("  - %s\n", pattern)
-            }
-
-            
-            stats := addressStats[addr]
-            fmt.Printf("  Statistics:\n")
-            fmt.Printf("    - Total Transactions: %d\n", stats.totalTransactions)
-            fmt.Printf("    - Total Volume: %.8f BTC\n", stats.totalVolume)
-            fmt.Printf("    - Last Seen: %s\n", stats.lastSeen.Format("2006-01-02 15:04:05"))
-            fmt.Printf("    - Transaction Types: In: %d, Out: %d\n", 
-                stats.transactionTypes["in"], stats.transactionTypes["out"])
-        }
-    }
-
-    
-    fmt.Printf("\n%s2. Temporal Analysis%s\n", Headers, Reset)
-    if len(rapidTransactions) > 0 {
-        fmt.Printf("\n%sRapid Transaction Sequences:%s\n", Yellow, Reset)
-        for timeWindow, txIds := range rapidTransactions {
-            fmt.Printf("Time Window: %s\n", timeWindow.Format("2006-01-02 15:04:05"))
-            fmt.Printf("Number of transactions: %d\n", len(txIds))
-            fmt.Printf("Transaction IDs: %v\n", txIds)
-        }
-    }
-
-    
-    fmt.Printf("\n%s3. Volume Analysis%s\n", Headers, Reset)
-    var highValueTxs []string
-    var spikeTransactions []string
-    var previousTxValue float64
-    for _, tx := range transactions {
-        details := txDetails[tx.TxID]
-        if math.Abs(details.Amount) > HIGH_VALUE_THRESHOLD {
-            highValueTxs = append(highValueTxs, fmt.Sprintf("TxID: %s, Amount: %.8f BTC", 
-                tx.TxID, math.Abs(details.Amount)))
-        }
-
-        if previousTxValue != 0 && math.Abs(details.Amount) > previousTxValue * 1.5 {
-            spikeTransactions = append(spikeTransactions, fmt.Sprintf("TxID: %s, Amount: %.8f BTC (Spike)", 
-                tx.TxID, math.Abs(details.Amount)))
-        }
-        previousTxValue = math.Abs(details.Amount)
-    }
-    
-    if len(highValueTxs) > 0 {
-        fmt.Printf("\n%sHigh-Value Transactions:%s\n", Yellow, Reset)
-        for _, tx := range highValueTxs {
-            fmt.Printf("- %s\n", tx)
-        }
-    }
-    if len(spikeTransactions) > 0 {
-        fmt.Printf("\n%sSpike Transactions:%s\n", Yellow, Reset)
-        for _, tx := range spikeTransactions {
-            fmt.Printf("- %s\n", tx)
-        }
-    }
-
-    
-    fmt.Printf("\n%s4. Network Analysis%s\n", Headers, Reset)
-    var frequentInteractors []struct {
-        address string
-        count   int
-        volume  float64
-    }
-
-    for addr, stats := range addressStats {
-        if addr == address {
-            continue
-        }
-
-
-        if stats.totalTransactions > 4 {
-            frequentInteractors = append(frequentInteractors, struct {
-                address string
-                count   int
-                volume  float64
-            }{addr, stats.totalTransactions, stats.totalVolume})
-        }
-    }
+	lines := []string{
+		"Address: " + wallet.Address,
+		"Address Type: " + string(addrInfo.Type),
+	}
+	if l, _, ok := labels.Lookup(wallet.Address); ok {
+		label := l.Label
+		if l.Category != "" {
+			label += " (" + l.Category + ")"
+		}
+		lines = append(lines, "Label: "+label)
+	}
+	lines = append(lines,
+		fmt.Sprintf("Total Received: %.8f BTC", bitcoinReceived),
+		fmt.Sprintf("Total Sent: %.8f BTC", bitcoinSent),
+		fmt.Sprintf("Current Balance: %.8f BTC", balance))
+
+	pending := pendingTotals(wallet.Address, wallet.Transactions)
+	if pending.IncomingCount+pending.OutgoingCount > 0 {
+		confirmed := float64(wallet.FinalBalance-pending.Incoming+pending.Outgoing) / 100_000_000
+		lines = append(lines,
+			fmt.Sprintf("Confirmed Balance: %.8f BTC", confirmed),
+			fmt.Sprintf("Pending Incoming: %.8f BTC (%d tx)", float64(pending.Incoming)/100_000_000, pending.IncomingCount),
+			fmt.Sprintf("Pending Outgoing: %.8f BTC (%d tx)", float64(pending.Outgoing)/100_000_000, pending.OutgoingCount))
+	}
+	if fiatEnabled() {
+		lines = append(lines, fmt.Sprintf("Current Value: $%.2f USD", balance*currentPrice))
+	} else {
+		lines = append(lines, "Network: "+string(network))
+	}
+	lines = append(lines, fmt.Sprintf("Total Transactions: %d", wallet.TxCount))
 
-    if len(frequentInteractors) > 0 {
-        fmt.Printf("\n%sFrequent Interactors:%s\n", Yellow, Reset)
-        for _, interactor := range frequentInteractors {
-            fmt.Printf("Address: %s\n", interactor.address)
-            fmt.Printf("  - Transaction Count: %d\n", interactor.count)
-            fmt.Printf("  - Total Volume: %.8f BTC\n", interactor.volume)
-        }
-    }
+	fmt.Println()
+	renderBox(os.Stdout, "Wallet Summary", lines, terminalWidth())
 }
 
 
@@ -581,7 +297,7 @@ func formatAddresses(addresses []string, limit int) string {
     var validAddresses []string
     for _, addr := range addresses {
         if addr != "" {
-            validAddresses = append(validAddresses, addr)
+            validAddresses = append(validAddresses, labelAddress(addr))
         }
     }
     
@@ -601,7 +317,8 @@ func formatAddresses(addresses []string, limit int) string {
 
 
 
-func analyzeWalletBehavior(transactions []Transaction, address string, txDetails map[string]TransactionDetails) {
+func analyzeWalletBehavior(transactions []Transaction, address string, txDetails map[string]TransactionDetails, clusters *Clusters, screening []ScreeningMatch) ([]analysis.Finding, Metrics) {
+    var findings []analysis.Finding
     // Analysis structures
     type AddressInteraction struct {
         totalVolume   float64
@@ -623,7 +340,6 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
 
     const (
         HIGH_VALUE_TX        = 1.0  // BTC
-        SUSPICIOUS_FREQUENCY = 10    // transactions per day
         WHALE_THRESHOLD      = 5.0   // BTC
         INACTIVE_PERIOD      = 30 * 24 * time.Hour
         SATOSHI_TO_BTC      = 1e-8
@@ -637,6 +353,8 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
         maxTxID             string
         maxTxTime           time.Time
         uniqueCounterparties = make(map[string]bool)
+        mixingVolume        float64
+        mixingTxs           []string
     )
 
    //First loop
@@ -653,14 +371,24 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
         for _, input := range tx.Inputs {
             if input.PrevOut.Addr == address {
                 isOutgoing = true
-                txVolume = float64(input.PrevOut.Value) * SATOSHI_TO_BTC
             } else if input.PrevOut.Addr != "" {
                 counterpartyAddresses = append(counterpartyAddresses, input.PrevOut.Addr)
                 uniqueCounterparties[input.PrevOut.Addr] = true
             }
         }
 
-        if !isOutgoing {
+        if isOutgoing {
+            // Co-spent inputs are our own coins, the payees are the counterparties
+            counterpartyAddresses = nil
+            payees, paid := paymentOutputs(detectChange(tx, address))
+            txVolume = float64(paid) * SATOSHI_TO_BTC
+            for _, payee := range payees {
+                if payee != "" && payee != address {
+                    counterpartyAddresses = append(counterpartyAddresses, payee)
+                    uniqueCounterparties[payee] = true
+                }
+            }
+        } else {
             for _, output := range tx.Out {
                 if output.Addr == address {
                     txVolume = float64(output.Value) * SATOSHI_TO_BTC
@@ -671,6 +399,17 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
             }
         }
 
+        // Mixing exposure: the wallet joined a CoinJoin, or was paid
+        // straight out of one
+        if match := detectCoinJoin(tx); match != nil {
+            mixingVolume += txVolume
+            mixingTxs = append(mixingTxs, fmt.Sprintf("%s: %s", tx.TxID, match))
+            findings = append(findings, analysis.Finding{
+                ID: "behavior.coinjoin", Severity: analysis.Low,
+                Message: "Mixing exposure through " + match.String(), TxIDs: []string{tx.TxID},
+            })
+        }
+
         // Update daily and monthly volumes
         dailyActivity[dayKey] += txVolume
         monthlyActivity[monthKey] += txVolume
@@ -686,20 +425,28 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
             maxTxTime = txTime
         }
 
-        // Update address interactions
+        // Update interactions per cluster, so an entity spending from
+        // several addresses counts once per transaction
+        seenClusters := make(map[string]bool)
         for _, addr := range counterpartyAddresses {
             if addr == "" || addr == address {
                 continue
             }
 
-            if _, exists := addressInteractions[addr]; !exists {
-                addressInteractions[addr] = &AddressInteraction{
+            cluster := clusters.Find(addr)
+            if _, exists := addressInteractions[cluster]; !exists {
+                addressInteractions[cluster] = &AddressInteraction{
                     firstSeen:  txTime,
                     addresses:  make(map[string]bool),
                 }
             }
+            interaction := addressInteractions[cluster]
+            interaction.addresses[addr] = true
+            if seenClusters[cluster] {
+                continue
+            }
+            seenClusters[cluster] = true
 
-            interaction := addressInteractions[addr]
             interaction.lastSeen = txTime
             interaction.frequency++
             
@@ -712,7 +459,6 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
             }
             
             interaction.totalVolume += txVolume
-            interaction.addresses[addr] = true
         }
 
         totalVolume += txVolume
@@ -731,32 +477,33 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
     
     // Temporal Analysis
     fmt.Printf("\n%s2. Activity Patterns%s\n", Cyan, Reset)
-    activeHours := make(map[int]int)
-    for _, tx := range transactions {
-        hour := time.Unix(int64(tx.Time), 0).Hour()
-        activeHours[hour]++
-    }
-    
-    var mostActiveHour int
-    var maxHourlyTx int
-    for hour, count := range activeHours {
-        if count > maxHourlyTx {
-            mostActiveHour = hour
-            maxHourlyTx = count
-        }
-    }
-    fmt.Printf("- Most Active Hour: %02d:00 UTC (%d transactions)\n", mostActiveHour, maxHourlyTx)
+    printFingerprint(buildFingerprint(transactions))
     
     
     fmt.Printf("\n%s3. Counterparty Analysis%s\n", Cyan, Reset)
     fmt.Printf("- Total Unique Counterparties: %d\n", len(uniqueCounterparties))
+    fmt.Printf("- Counterparty Entities (address clusters): %d\n", len(addressInteractions))
     
     var frequentPartners []string
     var highValuePartners []string
     var suspiciousAddrs []string
+    var linkedEntities []string
     
-    for addr, interaction := range addressInteractions {
+    for cluster, interaction := range addressInteractions {
         timeDiff := interaction.lastSeen.Sub(interaction.firstSeen)
+        addr := describeCluster(clusters, cluster)
+
+        if len(interaction.addresses) > 1 || clusters.Size(cluster) > 1 {
+            var members []string
+            for member := range interaction.addresses {
+                members = append(members, member)
+            }
+            sort.Strings(members)
+            linkedEntities = append(linkedEntities, fmt.Sprintf(
+                "%s: %d addresses in cluster, %d seen here (%s), %d transactions, %.8f BTC",
+                labelAddress(cluster), clusters.Size(cluster), len(members), formatAddresses(members, 3),
+                interaction.frequency, interaction.totalVolume))
+        }
         
         // Identify frequent partners
         if interaction.frequency >= 5 {
@@ -777,9 +524,25 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
             suspiciousAddrs = append(suspiciousAddrs, fmt.Sprintf(
                 "%s (%d transactions in %s)", 
                 addr, interaction.frequency, timeDiff.String()))
+            var members []string
+            for member := range interaction.addresses {
+                members = append(members, member)
+            }
+            sort.Strings(members)
+            findings = append(findings, analysis.Finding{
+                ID: "behavior.high-frequency", Severity: analysis.Medium,
+                Message: fmt.Sprintf("%d transactions in %s", interaction.frequency, timeDiff.String()), Addresses: members,
+            })
         }
     }
     
+    if len(linkedEntities) > 0 {
+        fmt.Printf("\n%sLinked Address Clusters (common-input-ownership):%s\n", Yellow, Reset)
+        for _, entity := range linkedEntities {
+            fmt.Printf("- %s\n", entity)
+        }
+    }
+
     if len(frequentPartners) > 0 {
         fmt.Printf("\n%sFrequent Transaction Partners:%s\n", Yellow, Reset)
         for _, partner := range frequentPartners {
@@ -808,107 +571,75 @@ func analyzeWalletBehavior(transactions []Transaction, address string, txDetails
     fmt.Printf("- Average Daily Volume: %.8f BTC\n", totalVolume/float64(len(dailyActivity)))
     fmt.Printf("- Transactions per Day: %.2f\n", float64(len(transactions))/float64(len(dailyActivity)))
 
-    // Risk Assessment
-    riskScore := 0
-    riskFactors := make([]string, 0)
-    
-    if len(suspiciousAddrs) > 0 {
-        riskScore++
-        riskFactors = append(riskFactors, "High frequency trading patterns detected")
-    }
-    if maxDailyVolume > WHALE_THRESHOLD {
-        riskScore++
-        riskFactors = append(riskFactors, "Large daily volume spikes")
-    }
-    if float64(len(transactions))/float64(len(dailyActivity)) > SUSPICIOUS_FREQUENCY {
-        riskScore++
-        riskFactors = append(riskFactors, "Unusually high transaction frequency")
-    }
-    
-    fmt.Printf("\n%s5. Risk Assessment%s\n", Headers, Reset)
-    switch {
-    case riskScore >= 2:
-        fmt.Printf("%sHIGH RISK - Multiple suspicious patterns detected%s\n", Red, Reset)
-    case riskScore == 1:
-        fmt.Printf("%sMEDIUM RISK - Some unusual patterns detected%s\n", Yellow, Reset)
-    default:
-        fmt.Printf("%sLOW RISK - No significant suspicious patterns detected%s\n", Green, Reset)
-    }
-    
-    if len(riskFactors) > 0 {
-        fmt.Printf("Risk factors identified:\n")
-        for _, factor := range riskFactors {
-            fmt.Printf("- %s\n", factor)
+    if len(mixingTxs) > 0 {
+        fmt.Printf("\n%sCoinJoin Transactions:%s\n", Yellow, Reset)
+        for _, mix := range mixingTxs {
+            fmt.Printf("- %s\n", mix)
         }
     }
-}
-
-
-
-
-func main() {
-	address := flag.String("wallet", "", "Bitcoin wallet address to monitor")
-	flag.Parse()
-
-	if *address == "" {
-		log.Fatal("Please provide a wallet address using the -wallet flag")
-	}
-    
-
-
-    db, err := sql.Open("sqlite3", "btcprice.db")
-	if err != nil {
-		fmt.Println("Error opening database:", err)
-		return
-	}
-	defer db.Close()
 
-	
-
-    priceToday, err := GetPrice(int64(time.Now().Unix()))
-    
-    if err != nil {
-        fmt.Println("Api Limit Exhausted local database will be used:", err)
-
-		priceToday,err = GetPrice2(db,int64(time.Now().Unix()))
+    // Blocklisted counterparties outweigh every behavioural signal
+    if len(screening) > 0 {
+        fmt.Printf("\n%sBlocklisted counterparties:%s\n", Red, Reset)
+        for _, match := range screening {
+            fmt.Printf("- %s\n", match.String())
+        }
+    }
 
-		if err != nil{
- 
-			fmt.Println("error occured:",err)
-			return
-		}
+    // Scored by the risk rules once every analyzer ran
+    metrics := Metrics{
+        "tx_count":                      float64(len(transactions)),
+        "total_volume_btc":              totalVolume,
+        "max_tx_btc":                    maxTxValue,
+        "avg_tx_btc":                    totalVolume / float64(len(transactions)),
+        "max_daily_volume_btc":          maxDailyVolume,
+        "active_days":                   float64(len(dailyActivity)),
+        "active_months":                 float64(len(monthlyActivity)),
+        "tx_per_day":                    float64(len(transactions)) / float64(len(dailyActivity)),
+        "counterparty_clusters":         float64(len(addressInteractions)),
+        "linked_clusters":               float64(len(linkedEntities)),
+        "frequent_partners":             float64(len(frequentPartners)),
+        "high_value_partners":           float64(len(highValuePartners)),
+        "high_frequency_counterparties": float64(len(suspiciousAddrs)),
+        "coinjoin_count":                float64(len(mixingTxs)),
+        "mixing_volume_pct":             0,
     }
+    if totalVolume > 0 {
+        metrics["mixing_volume_pct"] = 100 * mixingVolume / totalVolume
+    }
+    return findings, metrics
+}
 
-	wallet, err := fetchWallet(*address)
-	if err != nil {
-		log.Fatalf("Error fetching wallet: %v", err)
-	}
 
-	printWalletSummary(wallet,priceToday.Usd)
 
 
-	//var wg sync.WaitGroup
+// Amounts, prices, display addresses and flags of every tx, shared by
+// the table and the analyzers
+func buildTransactionDetails(db *sql.DB, wallet *WalletResponse, address string) map[string]TransactionDetails {
 	txDetails := make(map[string]TransactionDetails)
-	//var txMutex sync.Mutex
 
-	printTableHeader()
+	// Dust is flagged in the table, the dust analyzer reports the details
+	dustByTx := dustEventsByTx(detectDust(wallet.Transactions, address))
 
 	for _, tx := range wallet.Transactions {
 		
-		amount, err := getTransactionAmount(*address, tx.TxID)
+		amount, err := backend.TransactionAmount(address, tx)
 		if err != nil {
 			log.Printf("Error fetching transaction %s: %v", tx.TxID, err)
 			continue
 		}
 	
 		
-		price, err := GetPrice(int64(tx.Time))
-		if err != nil {
-			log.Printf("Error fetching price for transaction %s: %v", tx.TxID, err)
-			price, err = GetPrice2(db, int64(tx.Time))
+		price := &HistoricalPrice{}
+		if fiatEnabled() {
+			price, err = GetPrice(int64(tx.Time))
 			if err != nil {
-				fmt.Printf("Error occurred while fetching fallback price for transaction %s: %v\n", tx.TxID, err)
-				continue
+				log.Printf("Error fetching price for transaction %s: %v", tx.TxID, err)
+				price, err = GetPrice2(db, int64(tx.Time))
+				if err != nil {
+					fmt.Printf("Error occurred while fetching fallback price for transaction %s: %v\n", tx.TxID, err)
+					continue
+				}
 			}
 		}
 	
@@ -933,29 +664,182 @@ func main() {
 
 
 		
-		btcAmount := float64(*amount) / 100_000_000
+		btcAmount := float64(amount) / 100_000_000
 
 		var displayOrigin, displayDest string
+		var paymentAmount float64
 		if btcAmount > 0 {
 			
 			displayOrigin = formatAddresses(originAddresses, 1)
-			displayDest = wallet.Address
+			displayDest = labelAddress(wallet.Address)
 		} else {
-			
-			displayOrigin = wallet.Address
-			displayDest = formatAddresses(destAddresses, 1)
+			// Show the real payee rather than whichever output came first
+			payees, paid := paymentOutputs(detectChange(tx, wallet.Address))
+			displayOrigin = labelAddress(wallet.Address)
+			displayDest = formatAddresses(payees, 1)
+			paymentAmount = float64(paid) / 100_000_000
+		}
+
+		var flags []string
+		if match := detectCoinJoin(tx); match != nil {
+			flags = append(flags, "CJ:"+match.Kind)
+		}
+		if events := dustByTx[tx.TxID]; len(events) > 0 {
+			flags = append(flags, events[0].Flag())
 		}
 		txDetails[tx.TxID] = TransactionDetails{
 			Amount:        btcAmount,
 			Price:         price.Usd,
 			Time:          time.Unix(int64(tx.Time), 0),
 			Confirmations: tx.Confirmations,
+			Pending:       tx.Pending(),
+			RBF:           tx.SignalsRBF(),
+			PaymentAmount: paymentAmount,
+			Flags:         flags,
 			DisplayOrigin:   displayOrigin,
             DisplayDest:     displayDest,
 		
 		}
 	}
+	return txDetails
+}
+
+func main() {
+	// Subcommands without -color still honour NO_COLOR and pipes
+	if err := setupColor("auto"); err != nil {
+		log.Fatal(err)
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "trace":
+			runTrace(os.Args[2:])
+			return
+		case "screen":
+			runScreen(os.Args[2:])
+			return
+		case "registry":
+			runRegistry(os.Args[2:])
+			return
+		case "labels":
+			runLabels(os.Args[2:])
+			return
+		case "rules":
+			runRules(os.Args[2:])
+			return
+		case "fingerprint":
+			runFingerprint(os.Args[2:])
+			return
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "tui":
+			runTUI(os.Args[2:])
+			return
+		}
+	}
+
+	address := flag.String("wallet", "", "Bitcoin wallet address to monitor")
+	common := addCommonFlags(flag.CommandLine)
+	feeRate := flag.Float64("feerate", 10, "Feerate in sat/vB used to decide which UTXOs are dust")
+	clusterHops := flag.Int("cluster-hops", 0, "Fetch counterparties (1 hop) to extend address clustering")
+	clusterLimit := flag.Int("cluster-limit", 20, "Max counterparties fetched when -cluster-hops is 1")
+	peelTx := flag.String("peel", "", "Trace a peel chain forward from this txid and exit")
+	peelWallet := flag.Bool("peel-wallet", false, "Trace peel chains from the wallet's outgoing transactions")
+	peelDepth := flag.Int("peel-depth", 10, "Max transactions followed when tracing a peel chain")
+	screenHops := flag.Int("screen-hops", 0, "Also screen addresses 1 hop from the wallet's transactions")
+	screenLimit := flag.Int("screen-limit", 50, "Max backend requests for -screen-hops")
+	rulesPath := flag.String("risk-rules", "", "YAML file with risk scoring rules (see: rules)")
+	graphPath := flag.String("graph", "", "Write the transaction graph to this file (.graphml, .dot or .json)")
+	graphFormatName := flag.String("graph-format", "", "Graph format: graphml, dot or json (default: from the -graph extension)")
+	graphHops := flag.Int("graph-hops", 1, "Transaction hops around the wallet included in the graph")
+	graphLimit := flag.Int("graph-limit", 50, "Max wallets fetched for -graph-hops above 1")
+	analyzerList := flag.String("analyzers", "default", "Comma separated analyzers to run: "+strings.Join(analyzerNames(), ", ")+", default or all")
+	flag.Parse()
+	common.apply()
+
+	if *peelWallet {
+		*analyzerList += ",peel"
+	}
+	analyzers, err := parseAnalyzers(*analyzerList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *graphPath != "" {
+		if _, err := graphFormat(*graphPath, *graphFormatName); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	rules, err := loadRiskRules(*rulesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	riskRules = rules
+
+	if *peelTx != "" {
+		if err := runPeelTrace(*peelTx, *peelDepth); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *address == "" {
+		log.Fatal("Please provide a wallet address using the -wallet flag")
+	}
+
+	addrInfo, err := validateAddress(*address, network)
+	if err != nil {
+		log.Fatalf("Invalid wallet address: %v", err)
+	}
+    
+
+
+    db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		fmt.Println("Error opening database:", err)
+		return
+	}
+	defer db.Close()
+
 	
+
+	priceToday := &HistoricalPrice{}
+	if fiatEnabled() {
+		priceToday, err = GetPrice(int64(time.Now().Unix()))
+		if err != nil {
+			fmt.Println("Api Limit Exhausted local database will be used:", err)
+
+			priceToday, err = GetPrice2(db, int64(time.Now().Unix()))
+			if err != nil {
+				fmt.Println("error occured:", err)
+				return
+			}
+		}
+	}
+
+	wallet, err := backend.FetchWallet(*address)
+	if err != nil {
+		log.Fatalf("Error fetching wallet: %v", err)
+	}
+
+	// Clusters are needed up front so labels cover linked addresses in the table
+	clusters := buildClusters(wallet.Transactions)
+	if *clusterHops > 0 {
+		expandClusters(clusters, wallet.Transactions, *address, *clusterLimit)
+	}
+	if labels, err = loadLabels(db); err != nil {
+		log.Fatalf("Error loading labels: %v", err)
+	}
+	labels.clusters = clusters
+
+	printWalletSummary(wallet,addrInfo,priceToday.Usd)
+
+
+	txDetails := buildTransactionDetails(db, wallet, *address)
+
+	table := newTransactionTable()
+
 	// Process and display the transaction details
 	for _, tx := range wallet.Transactions {
 		details, ok := txDetails[tx.TxID]
@@ -964,28 +848,69 @@ func main() {
 		}
 	
 		color := Green
+		amount := details.Amount
 		if details.Amount < 0 {
 			color = Red
+			amount = -details.PaymentAmount
+		}
+	
+		usdValue := "n/a"
+		if fiatEnabled() {
+			usdValue = fmt.Sprintf("$%.2f", amount*details.Price)
 		}
 	
-		fmt.Printf("║ %-20s │ %s%-15.8f%s │ %-12d │ $%-14.2f │ %-20s │ %-30s │ %-30s ║\n",
-    tx.TxID[:20],
-    color, details.Amount, Reset,
-    details.Confirmations,
-    details.Amount*details.Price,
-    details.Time.Format("2006-01-02 15:04:05"),
-    details.DisplayOrigin,
-    details.DisplayDest)
+		confirmations := fmt.Sprintf("%d", details.Confirmations)
+		if details.Pending {
+			confirmations = "pending"
+			if details.RBF {
+				confirmations = "pending RBF"
+			}
+		}
+	
+		table.AddRow(
+			Cell{Text: tx.TxID},
+			Cell{Text: fmt.Sprintf("%.8f", amount), Color: color},
+			Cell{Text: confirmations},
+			Cell{Text: usdValue},
+			Cell{Text: formatFee(tx)},
+			Cell{Text: details.Time.Format("2006-01-02 15:04:05")},
+			Cell{Text: details.DisplayOrigin},
+			Cell{Text: details.DisplayDest},
+			Cell{Text: strings.Join(details.Flags, ",")})
 	}
 	
-	fmt.Printf("%s╚══════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════╝%s\n", Headers, Reset)
+	fmt.Println()
+	table.Render(os.Stdout, terminalWidth())
 
 
 
 
-	//analyzeTransactionPatterns(wallet.Transactions,*address,txDetails)
-    analyzeWalletBehavior(wallet.Transactions,*address,txDetails)
-    
-    
-    fmt.Println(Suspiciouswallets)
+    // Screening always runs, blocklist matches are findings even without the behaviour report
+    screening, err := screenTransactions(db, wallet.Transactions, *address, *screenHops, *screenLimit)
+    if err != nil {
+        log.Printf("Error screening counterparties: %v", err)
+    }
+
+    state := &runState{db: db, clusters: clusters, screening: screening, price: priceToday.Usd, feeRate: *feeRate, peelDepth: *peelDepth}
+    ctx := &analysis.Context{Address: *address, Transactions: wallet.Transactions, Details: txDetails, Fetcher: backend, State: state}
+    findings := append(screeningFindings(screening), runAnalyzers(analyzers, ctx)...)
+    printFindings(findings)
+
+    // Counterparties flagged by the pattern analyzers or named in high or
+    // critical findings go to the registry
+    for _, f := range registryFlags(findings, *address) {
+        flagSuspicious(f.Address, f.Reason)
+    }
+
+    if *graphPath != "" {
+        exportRunGraph(*graphPath, *graphFormatName, wallet.Transactions, *address, *graphHops, *graphLimit, txDetails)
+    }
+
+    if len(Suspiciouswallets) > 0 {
+        if err := saveSuspiciousFlags(db, *address, Suspiciouswallets); err != nil {
+            log.Printf("Error saving suspicious wallets: %v", err)
+        } else {
+            fmt.Printf("\n%s%d flags saved to the suspicious wallet registry (see: registry list)%s\n", Yellow, len(Suspiciouswallets), Reset)
+        }
+    }
 }
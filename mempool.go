@@ -0,0 +1,283 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+// Unconfirmed totals for the summary, in satoshis
+type PendingTotals struct {
+	Incoming      int64
+	Outgoing      int64
+	IncomingCount int
+	OutgoingCount int
+}
+
+func pendingTotals(address string, transactions []Transaction) PendingTotals {
+	var totals PendingTotals
+	for _, tx := range transactions {
+		if !tx.Pending() {
+			continue
+		}
+		amount := netAmount(address, tx)
+		if amount >= 0 {
+			totals.Incoming += amount
+			totals.IncomingCount++
+		} else {
+			totals.Outgoing += -amount
+			totals.OutgoingCount++
+		}
+	}
+	return totals
+}
+
+// What happened to a pending tx seen on an earlier run
+type MempoolEvent struct {
+	TxID        string
+	Amount      int64
+	Kind        string // confirmed, replaced, dropped
+	ReplacedBy  string
+	DoubleSpend bool
+	FirstSeen   time.Time
+}
+
+func initMempoolTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS mempool_watch (
+            address    TEXT NOT NULL,
+            txid       TEXT NOT NULL,
+            amount     INTEGER NOT NULL,
+            outpoints  TEXT NOT NULL,
+            rbf        INTEGER NOT NULL,
+            first_seen INTEGER NOT NULL,
+            PRIMARY KEY (address, txid)
+        )`)
+	return err
+}
+
+// Compares the pending txs stored on the previous run with the current
+// history, then stores the txs that are still pending for the next run
+// unless readOnly is set. Spenders outside the history are looked up
+// through fetcher when there is one
+func trackMempool(db *sql.DB, fetcher analysis.Fetcher, address string, transactions []Transaction, readOnly bool) ([]MempoolEvent, error) {
+	if err := initMempoolTable(db); err != nil {
+		return nil, fmt.Errorf("failed to create mempool table: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT txid, amount, outpoints, first_seen FROM mempool_watch WHERE address = ?`, address)
+	if err != nil {
+		return nil, err
+	}
+	type watched struct {
+		txid      string
+		amount    int64
+		inputs    []Input
+		firstSeen time.Time
+	}
+	var previous []watched
+	for rows.Next() {
+		var w watched
+		var outpoints string
+		var firstSeen int64
+		if err := rows.Scan(&w.txid, &w.amount, &outpoints, &firstSeen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for _, outpoint := range strings.Split(outpoints, ",") {
+			sep := strings.LastIndex(outpoint, ":")
+			if sep < 0 {
+				continue
+			}
+			var in Input
+			in.PrevOut.TxID = outpoint[:sep]
+			fmt.Sscanf(outpoint[sep+1:], "%d", &in.PrevOut.N)
+			w.inputs = append(w.inputs, in)
+		}
+		w.firstSeen = time.Unix(firstSeen, 0)
+		previous = append(previous, w)
+	}
+	rows.Close()
+
+	byID := make(map[string]Transaction)
+	spentBy := make(map[string]Transaction)
+	for _, tx := range transactions {
+		byID[tx.TxID] = tx
+		for _, in := range tx.Inputs {
+			spentBy[in.Outpoint()] = tx
+		}
+	}
+
+	var events []MempoolEvent
+	for _, w := range previous {
+		event := MempoolEvent{TxID: w.txid, Amount: w.amount, FirstSeen: w.firstSeen}
+
+		if tx, ok := byID[w.txid]; ok {
+			if tx.Pending() {
+				continue
+			}
+			event.Kind = "confirmed"
+			events = append(events, event)
+			continue
+		}
+
+		// Gone from the history, look for a tx spending the same coins.
+		// A double spend usually doesn't touch our address so ask the backend
+		event.Kind = "dropped"
+		for _, in := range w.inputs {
+			replacement, ok := spentBy[in.Outpoint()]
+			if !ok && fetcher == nil {
+				continue
+			}
+			if !ok {
+				spender, err := fetcher.FetchOutspend(in.PrevRef(), in.PrevOut.N)
+				if err != nil || spender == nil {
+					continue
+				}
+				replacement = *spender
+			}
+			event.Kind = "replaced"
+			event.ReplacedBy = replacement.TxID
+			// An incoming payment whose inputs now pay us less was double spent
+			if w.amount > 0 && netAmount(address, replacement) < w.amount {
+				event.DoubleSpend = true
+			}
+			break
+		}
+		events = append(events, event)
+	}
+
+	if readOnly {
+		return events, nil
+	}
+
+	// Remember what is pending now
+	if _, err := db.Exec(`DELETE FROM mempool_watch WHERE address = ?`, address); err != nil {
+		return nil, err
+	}
+	firstSeen := make(map[string]time.Time)
+	for _, w := range previous {
+		firstSeen[w.txid] = w.firstSeen
+	}
+	for _, tx := range transactions {
+		if !tx.Pending() {
+			continue
+		}
+		var outpoints []string
+		for _, in := range tx.Inputs {
+			outpoints = append(outpoints, in.Outpoint())
+		}
+		seen, ok := firstSeen[tx.TxID]
+		if !ok {
+			seen = time.Unix(int64(tx.Time), 0)
+		}
+		_, err := db.Exec(`INSERT INTO mempool_watch (address, txid, amount, outpoints, rbf, first_seen) VALUES (?, ?, ?, ?, ?, ?)`,
+			address, tx.TxID, netAmount(address, tx), strings.Join(outpoints, ","), tx.SignalsRBF(), seen.Unix())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func mempoolMetrics(transactions []Transaction, events []MempoolEvent) Metrics {
+	metrics := Metrics{"pending_txs": 0, "replaced_txs": 0, "double_spends": 0, "dropped_txs": 0}
+	for _, tx := range transactions {
+		if tx.Pending() {
+			metrics["pending_txs"]++
+		}
+	}
+	for _, event := range events {
+		switch event.Kind {
+		case "replaced":
+			metrics["replaced_txs"]++
+		case "dropped":
+			metrics["dropped_txs"]++
+		}
+		if event.DoubleSpend {
+			metrics["double_spends"]++
+		}
+	}
+	return metrics
+}
+
+// Double spends of incoming payments are High, other replacements (fee
+// bumps, cancelled sends) and dropped txs Low
+func mempoolFindings(events []MempoolEvent) []analysis.Finding {
+	var findings []analysis.Finding
+	for _, event := range events {
+		switch {
+		case event.DoubleSpend:
+			findings = append(findings, analysis.Finding{
+				ID: "mempool.double-spend", Severity: analysis.High, TxIDs: []string{event.TxID, event.ReplacedBy},
+				Message: fmt.Sprintf("Incoming payment of %.8f BTC was double spent", float64(event.Amount)/100_000_000),
+			})
+		case event.Kind == "replaced":
+			findings = append(findings, analysis.Finding{
+				ID: "mempool.replaced", Severity: analysis.Low, TxIDs: []string{event.TxID, event.ReplacedBy},
+				Message: fmt.Sprintf("Pending transaction of %.8f BTC was replaced before confirming", float64(event.Amount)/100_000_000),
+			})
+		case event.Kind == "dropped":
+			findings = append(findings, analysis.Finding{
+				ID: "mempool.dropped", Severity: analysis.Low, TxIDs: []string{event.TxID},
+				Message: "Pending transaction dropped from the mempool",
+			})
+		}
+	}
+	return findings
+}
+
+func printMempoolReport(address string, transactions []Transaction, events []MempoolEvent) {
+	var pending []Transaction
+	for _, tx := range transactions {
+		if tx.Pending() {
+			pending = append(pending, tx)
+		}
+	}
+	if len(pending) == 0 && len(events) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s=== Mempool Activity ===%s\n", Headers, Reset)
+
+	for _, event := range events {
+		if event.DoubleSpend {
+			fmt.Printf("%sALERT: incoming payment %s (%.8f BTC) was double spent by %s%s\n",
+				Red, event.TxID, float64(event.Amount)/100_000_000, event.ReplacedBy, Reset)
+		}
+	}
+
+	if len(pending) > 0 {
+		fmt.Printf("\n%sPending Transactions:%s\n", Yellow, Reset)
+		for _, tx := range pending {
+			direction := "incoming"
+			amount := netAmount(address, tx)
+			if amount < 0 {
+				direction = "outgoing"
+			}
+			rbf := ""
+			if tx.SignalsRBF() {
+				rbf = " [RBF - can still be replaced]"
+			}
+			fmt.Printf("- %s %s %.8f BTC%s\n", tx.TxID, direction, float64(amount)/100_000_000, rbf)
+		}
+	}
+
+	if len(events) > 0 {
+		fmt.Printf("\n%sSince Last Run:%s\n", Yellow, Reset)
+		for _, event := range events {
+			switch event.Kind {
+			case "confirmed":
+				fmt.Printf("- %s confirmed (pending since %s)\n", event.TxID, event.FirstSeen.Format("2006-01-02 15:04:05"))
+			case "replaced":
+				fmt.Printf("- %s was replaced by %s\n", event.TxID, event.ReplacedBy)
+			default:
+				fmt.Printf("- %s disappeared from the mempool without confirming\n", event.TxID)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"crypto_tracker/analysis"
+)
+
+// Pending on the first run: an incoming payment, an outgoing payment, a
+// payment that disappears and one that confirms
+func testMempoolRun() []Transaction {
+	txs := []Transaction{
+		testTx("inc", 1_700_000_000, []testIO{{testLegacy, 1_001_000}}, []testIO{{testWatched, 1_000_000}}),
+		testTx("bump", 1_700_000_000, []testIO{{testWatched, 2_000_000}}, []testIO{{testSegwit, 1_000_000}, {testWatched, 999_000}}),
+		testTx("gone", 1_700_000_000, []testIO{{testScript, 501_000}}, []testIO{{testWatched, 500_000}}),
+		testTx("conf", 1_700_000_000, []testIO{{testLegacy, 301_000}}, []testIO{{testWatched, 300_000}}),
+	}
+	for i := range txs {
+		txs[i].BlockHeight = 0
+	}
+	return txs
+}
+
+func testMempoolEvents(t *testing.T, fetcher analysis.Fetcher) []string {
+	db := testDB(t)
+	if _, err := trackMempool(db, fetcher, testWatched, testMempoolRun(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Next run: conf is mined, bump was fee bumped by bump2
+	conf := testMempoolRun()[3]
+	conf.BlockHeight = 100
+	bump2 := testTx("bump2", 1_700_000_600, []testIO{{testWatched, 2_000_000}}, []testIO{{testSegwit, 1_000_000}, {testWatched, 990_000}})
+	bump2.Inputs[0].PrevOut.TxID = "bump-prev"
+	bump2.BlockHeight = 0
+
+	events, err := trackMempool(db, fetcher, testWatched, []Transaction{conf, bump2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, fmt.Sprintf("%s:%s:%s:%v", event.TxID, event.Kind, event.ReplacedBy, event.DoubleSpend))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestTrackMempool(t *testing.T) {
+	// The double spend pays the sender back and never touches the wallet
+	steal := testTx("steal", 1_700_000_300, []testIO{{testLegacy, 1_001_000}}, []testIO{{testLegacy, 1_000_000}})
+	fetcher := &testFetcher{outspends: map[string]Transaction{"inc-prev:0": steal}}
+
+	tests := []struct {
+		name    string
+		fetcher analysis.Fetcher
+		events  string
+	}{
+		{"with a fetcher", fetcher, "[bump:replaced:bump2:false conf:confirmed::false gone:dropped::false inc:replaced:steal:true]"},
+		{"without a fetcher", nil, "[bump:replaced:bump2:false conf:confirmed::false gone:dropped::false inc:dropped::false]"},
+	}
+	for _, tt := range tests {
+		if got := testMempoolEvents(t, tt.fetcher); fmt.Sprint(got) != tt.events {
+			t.Errorf("%s: events %v, want %s", tt.name, got, tt.events)
+		}
+	}
+}
+
+func TestTrackMempoolReadOnly(t *testing.T) {
+	db := testDB(t)
+	if _, err := trackMempool(db, nil, testWatched, testMempoolRun(), false); err != nil {
+		t.Fatal(err)
+	}
+	for run := 0; run < 2; run++ {
+		events, err := trackMempool(db, nil, testWatched, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 4 {
+			t.Errorf("read-only run %d: %d events, want the 4 stored txs each time", run, len(events))
+		}
+	}
+}
+
+func TestMempoolFindings(t *testing.T) {
+	events := []MempoolEvent{
+		{TxID: "inc", Amount: 1_000_000, Kind: "replaced", ReplacedBy: "steal", DoubleSpend: true},
+		{TxID: "bump", Amount: -1_001_000, Kind: "replaced", ReplacedBy: "bump2"},
+		{TxID: "gone", Amount: 500_000, Kind: "dropped"},
+		{TxID: "conf", Amount: 300_000, Kind: "confirmed"},
+	}
+	var got []string
+	for _, f := range mempoolFindings(events) {
+		got = append(got, fmt.Sprintf("%s:%s:%v", f.ID, f.Severity, f.TxIDs))
+	}
+	want := "[mempool.double-spend:high:[inc steal] mempool.replaced:low:[bump bump2] mempool.dropped:low:[gone]]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("findings %v, want %s", got, want)
+	}
+
+	metrics := mempoolMetrics(nil, events)
+	if metrics["replaced_txs"] != 2 || metrics["double_spends"] != 1 || metrics["dropped_txs"] != 1 {
+		t.Errorf("metrics %v, want 2 replaced, 1 double spend, 1 dropped", metrics)
+	}
+}
+
+func TestPendingTotals(t *testing.T) {
+	txs := testMempoolRun()
+	txs[3].BlockHeight = 100
+	totals := pendingTotals(testWatched, txs)
+	if totals.Incoming != 1_500_000 || totals.IncomingCount != 2 || totals.Outgoing != 1_001_000 || totals.OutgoingCount != 1 {
+		t.Errorf("pending totals %+v, want 1500000 in over 2 txs and 1001000 out over 1", totals)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// Default Esplora endpoints for the test networks. Regtest expects a local
+// electrs/esplora instance (electrs serves its HTTP API on 3002 for regtest)
+var defaultBackendURLs = map[Network]string{
+	Testnet: "https://blockstream.info/testnet/api",
+	Signet:  "https://mempool.space/signet/api",
+	Regtest: "http://127.0.0.1:3002",
+}
+
+// Where wallet and transaction data comes from
+type Backend interface {
+	FetchWallet(address string) (*WalletResponse, error)
+	TransactionAmount(address string, tx Transaction) (int64, error)
+	// ref is a txid, or a tx_index on blockchain.info
+	FetchTransaction(ref string) (*Transaction, error)
+	// Tx spending output n of ref, nil when it is unspent
+	FetchOutspend(ref string, n int) (*Transaction, error)
+}
+
+var (
+	network         = Mainnet
+	backend Backend = &blockchainInfoBackend{}
+)
+
+func parseNetwork(name string) (Network, error) {
+	switch n := Network(strings.ToLower(name)); n {
+	case Mainnet, Testnet, Signet, Regtest:
+		return n, nil
+	}
+	return "", fmt.Errorf("unknown network %q (expected mainnet, testnet, signet or regtest)", name)
+}
+
+// Selects the network and the backend used for it. baseURL overrides the
+// default endpoint; any override is treated as an Esplora API
+func setupNetwork(n Network, baseURL string) {
+	network = n
+	if baseURL == "" {
+		baseURL = defaultBackendURLs[n]
+	}
+	if baseURL == "" {
+		backend = &blockchainInfoBackend{}
+		return
+	}
+	backend = &esploraBackend{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// Network selection flags shared by the main report and the subcommands
+type commonFlags struct {
+	network *string
+	backend *string
+	color   *string
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		network: fs.String("network", "mainnet", "Bitcoin network: mainnet, testnet, signet or regtest"),
+		backend: fs.String("backend", "", "Esplora API base URL (defaults per network, e.g. a local electrs for regtest)"),
+		color:   fs.String("color", "auto", "Colored output: auto (terminal without NO_COLOR), always or never"),
+	}
+}
+
+func (c *commonFlags) apply() {
+	n, err := parseNetwork(*c.network)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setupNetwork(n, *c.backend)
+	if err := setupColor(*c.color); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Fiat prices only make sense for real coins
+func fiatEnabled() bool {
+	return network == Mainnet
+}
+
+//blockchain.info (mainnet)
+
+type blockchainInfoBackend struct{}
+
+func (b *blockchainInfoBackend) FetchWallet(address string) (*WalletResponse, error) {
+	wallet, err := fetchWallet(address)
+	if err != nil {
+		return nil, err
+	}
+
+	// rawaddr only gives block heights, confirmations come from the tip
+	tip, err := getBlockCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := range wallet.Transactions {
+		if height := wallet.Transactions[i].BlockHeight; height > 0 {
+			wallet.Transactions[i].Confirmations = tip - height + 1
+		}
+	}
+	return wallet, nil
+}
+
+func (b *blockchainInfoBackend) FetchTransaction(ref string) (*Transaction, error) {
+	resp, err := client.Get(fmt.Sprintf("https://blockchain.info/rawtx/%s", ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tx Transaction
+	if err := json.NewDecoder(resp.Body).Decode(&tx); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	if tx.BlockHeight > 0 {
+		tip, err := getBlockCount()
+		if err != nil {
+			return nil, err
+		}
+		tx.Confirmations = tip - tx.BlockHeight + 1
+	}
+	return &tx, nil
+}
+
+func (b *blockchainInfoBackend) FetchOutspend(ref string, n int) (*Transaction, error) {
+	resp, err := client.Get(fmt.Sprintf("https://blockchain.info/rawtx/%s", ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		Out []struct {
+			N                 int `json:"n"`
+			SpendingOutpoints []struct {
+				TxIndex int64 `json:"tx_index"`
+			} `json:"spending_outpoints"`
+		} `json:"out"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	for _, out := range raw.Out {
+		if out.N == n && len(out.SpendingOutpoints) > 0 {
+			return b.FetchTransaction(fmt.Sprintf("%d", out.SpendingOutpoints[0].TxIndex))
+		}
+	}
+	return nil, nil
+}
+
+func getBlockCount() (int, error) {
+	resp, err := client.Get("https://blockchain.info/q/getblockcount")
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch block height: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var height int
+	if err := json.NewDecoder(resp.Body).Decode(&height); err != nil {
+		return 0, fmt.Errorf("failed to parse block height: %v", err)
+	}
+	return height, nil
+}
+
+func (b *blockchainInfoBackend) TransactionAmount(address string, tx Transaction) (int64, error) {
+	amount, err := getTransactionAmount(address, tx.TxID)
+	if err != nil {
+		return 0, err
+	}
+	return int64(*amount), nil
+}
+
+//Esplora (blockstream.info, mempool.space, electrs)
+
+type esploraBackend struct {
+	baseURL string
+	tip     int
+}
+
+type esploraTx struct {
+	TxID   string `json:"txid"`
+	Status struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int   `json:"block_height"`
+		BlockTime   int64 `json:"block_time"`
+	} `json:"status"`
+	Vin []struct {
+		TxID     string `json:"txid"`
+		Vout     int    `json:"vout"`
+		Sequence uint32 `json:"sequence"`
+		Prevout  *struct {
+			Address string `json:"scriptpubkey_address"`
+			Value   int64  `json:"value"`
+		} `json:"prevout"`
+	} `json:"vin"`
+	Vout []struct {
+		Address string `json:"scriptpubkey_address"`
+		Value   int64  `json:"value"`
+	} `json:"vout"`
+	Fee    int64 `json:"fee"`
+	Size   int   `json:"size"`
+	Weight int   `json:"weight"`
+}
+
+// Max confirmed transactions to page through, same as blockchain.info's default
+const esploraTxLimit = 50
+
+func (e *esploraBackend) get(path string, v interface{}) error {
+	resp, err := client.Get(e.baseURL + path)
+	if err != nil {
+		return fmt.Errorf("failed to fetch data: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s returned %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return nil
+}
+
+func (e *esploraBackend) FetchWallet(address string) (*WalletResponse, error) {
+	var stats struct {
+		ChainStats struct {
+			Funded  int64 `json:"funded_txo_sum"`
+			Spent   int64 `json:"spent_txo_sum"`
+			TxCount int   `json:"tx_count"`
+		} `json:"chain_stats"`
+		MempoolStats struct {
+			Funded  int64 `json:"funded_txo_sum"`
+			Spent   int64 `json:"spent_txo_sum"`
+			TxCount int   `json:"tx_count"`
+		} `json:"mempool_stats"`
+	}
+	if err := e.get("/address/"+address, &stats); err != nil {
+		return nil, err
+	}
+
+	tip, err := e.tipHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	// First page has mempool txs plus the newest confirmed ones,
+	// further confirmed pages are keyed by the last txid seen
+	var txs []esploraTx
+	if err := e.get("/address/"+address+"/txs", &txs); err != nil {
+		return nil, err
+	}
+	for len(txs) > 0 && len(txs) < esploraTxLimit {
+		var page []esploraTx
+		last := txs[len(txs)-1].TxID
+		if err := e.get("/address/"+address+"/txs/chain/"+last, &page); err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		txs = append(txs, page...)
+	}
+
+	wallet := &WalletResponse{
+		Address:       address,
+		TotalReceived: stats.ChainStats.Funded + stats.MempoolStats.Funded,
+		TotalSent:     stats.ChainStats.Spent + stats.MempoolStats.Spent,
+		TxCount:       stats.ChainStats.TxCount + stats.MempoolStats.TxCount,
+	}
+	wallet.FinalBalance = wallet.TotalReceived - wallet.TotalSent
+
+	for _, etx := range txs {
+		wallet.Transactions = append(wallet.Transactions, etx.toTransaction(tip))
+	}
+	return wallet, nil
+}
+
+// Tip is fetched once per run, good enough for confirmation counts
+func (e *esploraBackend) tipHeight() (int, error) {
+	if e.tip > 0 {
+		return e.tip, nil
+	}
+	if err := e.get("/blocks/tip/height", &e.tip); err != nil {
+		return 0, err
+	}
+	return e.tip, nil
+}
+
+func (e *esploraBackend) FetchTransaction(ref string) (*Transaction, error) {
+	tip, err := e.tipHeight()
+	if err != nil {
+		return nil, err
+	}
+	var etx esploraTx
+	if err := e.get("/tx/"+ref, &etx); err != nil {
+		return nil, err
+	}
+	tx := etx.toTransaction(tip)
+	return &tx, nil
+}
+
+func (e *esploraBackend) FetchOutspend(ref string, n int) (*Transaction, error) {
+	var outspend struct {
+		Spent bool   `json:"spent"`
+		TxID  string `json:"txid"`
+	}
+	if err := e.get(fmt.Sprintf("/tx/%s/outspend/%d", ref, n), &outspend); err != nil {
+		return nil, err
+	}
+	if !outspend.Spent {
+		return nil, nil
+	}
+	return e.FetchTransaction(outspend.TxID)
+}
+
+func (etx esploraTx) toTransaction(tip int) Transaction {
+	tx := Transaction{
+		TxID:   etx.TxID,
+		Fee:    etx.Fee,
+		Size:   etx.Size,
+		Weight: etx.Weight,
+		VinSz:  len(etx.Vin),
+		VoutSz: len(etx.Vout),
+	}
+	if etx.Status.Confirmed {
+		tx.BlockHeight = etx.Status.BlockHeight
+		tx.Confirmations = tip - etx.Status.BlockHeight + 1
+		tx.Time = int(etx.Status.BlockTime)
+	} else {
+		tx.Time = int(time.Now().Unix())
+	}
+
+	for _, vin := range etx.Vin {
+		in := Input{Sequence: vin.Sequence}
+		in.PrevOut.TxID = vin.TxID
+		in.PrevOut.N = vin.Vout
+		if vin.Prevout != nil {
+			in.PrevOut.Addr = vin.Prevout.Address
+			in.PrevOut.Value = vin.Prevout.Value
+		}
+		tx.Inputs = append(tx.Inputs, in)
+	}
+	for n, vout := range etx.Vout {
+		tx.Out = append(tx.Out, Output{Addr: vout.Address, Value: vout.Value, N: n})
+	}
+	return tx
+}
+
+// Net effect of the tx on the address, worked out locally since the
+// full prevouts are already included
+func (e *esploraBackend) TransactionAmount(address string, tx Transaction) (int64, error) {
+	return netAmount(address, tx), nil
+}
+
+// Satoshis the tx adds to (or removes from) the address
+func netAmount(address string, tx Transaction) int64 {
+	var amount int64
+	for _, in := range tx.Inputs {
+		if in.PrevOut.Addr == address {
+			amount -= in.PrevOut.Value
+		}
+	}
+	for _, out := range tx.Out {
+		if out.Addr == address {
+			amount += out.Value
+		}
+	}
+	return amount
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+// Codes the color names start with, kept so setupColor can put them back
+var colorCodes = []struct {
+	color *string
+	code  string
+}{{&Red, Red}, {&Green, Green}, {&Reset, Reset}, {&Blue, Blue}, {&Yellow, Yellow}, {&Cyan, Cyan}, {&Headers, Headers}}
+
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// "always" and "never" win. "auto" colors only a terminal, and only when
+// NO_COLOR (https://no-color.org) isn't set
+func colorEnabled(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		return os.Getenv("NO_COLOR") == "" && stdoutIsTerminal(), nil
+	}
+	return false, fmt.Errorf("unknown color mode %q (auto, always or never)", mode)
+}
+
+func setupColor(mode string) error {
+	enabled, err := colorEnabled(mode)
+	if err != nil {
+		return err
+	}
+	for _, c := range colorCodes {
+		if enabled {
+			*c.color = c.code
+		} else {
+			*c.color = ""
+		}
+	}
+	return nil
+}
+
+// Width tables are fitted to: the terminal, else $COLUMNS, else 0 for
+// no limit so piped output keeps every column in full
+func terminalWidth() int {
+	if stdoutIsTerminal() {
+		if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return 0
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+const (
+	HIGH_VALUE_THRESHOLD       = 1.0 // BTC
+	UNUSUAL_VARIANCE_THRESHOLD = 2.0 // BTC standard deviation
+	TEMPORAL_SPAM_THRESHOLD    = 3   // txs before daily volume counts as spam
+	FREQUENT_INTERVAL          = 1.0 // hours between txs of one counterparty
+	BURST_WINDOW               = time.Hour
+	BURST_MIN_TXS              = 3
+)
+
+// Per-counterparty activity. Each tx counts once per address, with the
+// value that address actually put in or took out
+type AddressStats struct {
+	totalTransactions int
+	totalVolume       float64
+	lastSeen          time.Time
+	lastTxID          string
+	transactionTypes  map[string]int // "in" = received from the tx, "out" = spent into it
+	amounts           []float64
+	timeDiffs         []float64 // hours since this address' previous tx
+	dailyVolume       map[string]float64
+}
+
+// Run of txs where every BURST_WINDOW holds at least BURST_MIN_TXS of them
+type TxBurst struct {
+	Start time.Time
+	End   time.Time
+	TxIDs []string
+}
+
+// Sliding window over the tx times, overlapping windows are merged
+func detectBursts(transactions []Transaction, window time.Duration, minTxs int) []TxBurst {
+	sorted := sortedByTime(transactions)
+
+	var bursts []TxBurst
+	start := 0
+	lastEnd := -1
+	for end := range sorted {
+		for time.Duration(sorted[end].Time-sorted[start].Time)*time.Second > window {
+			start++
+		}
+		if end-start+1 < minTxs {
+			continue
+		}
+		if len(bursts) > 0 && start <= lastEnd {
+			// Window overlaps the current burst, extend it
+			burst := &bursts[len(bursts)-1]
+			for i := lastEnd + 1; i <= end; i++ {
+				burst.TxIDs = append(burst.TxIDs, sorted[i].TxID)
+			}
+			burst.End = time.Unix(int64(sorted[end].Time), 0)
+		} else {
+			burst := TxBurst{
+				Start: time.Unix(int64(sorted[start].Time), 0),
+				End:   time.Unix(int64(sorted[end].Time), 0),
+			}
+			for i := start; i <= end; i++ {
+				burst.TxIDs = append(burst.TxIDs, sorted[i].TxID)
+			}
+			bursts = append(bursts, burst)
+		}
+		lastEnd = end
+	}
+	return bursts
+}
+
+// Value the wallet moved in a tx: received amount, or the payment
+// (without change and fee) when it sent
+func walletVolume(details TransactionDetails) float64 {
+	if details.Amount < 0 {
+		return details.PaymentAmount
+	}
+	return details.Amount
+}
+
+func analyzeTransactionPatterns(transactions []Transaction, address string, txDetails map[string]TransactionDetails) ([]analysis.Finding, Metrics) {
+	var findings []analysis.Finding
+	addressStats := make(map[string]*AddressStats)
+	unusualPatterns := make(map[string][]string)
+
+	// Oldest first so time deltas follow the real order
+	sorted := sortedByTime(transactions)
+
+	fmt.Printf("\n%s=== Security Analysis Report ===%s\n\n", Headers, Reset)
+
+	for _, tx := range sorted {
+		txTime := time.Unix(int64(tx.Time), 0)
+
+		// Sum per address first, an address spending several inputs is one counterparty
+		spent := make(map[string]int64)
+		received := make(map[string]int64)
+		for _, input := range tx.Inputs {
+			if input.PrevOut.Addr != "" {
+				spent[input.PrevOut.Addr] += input.PrevOut.Value
+			}
+		}
+		for _, output := range tx.Out {
+			if output.Addr != "" {
+				received[output.Addr] += output.Value
+			}
+		}
+
+		record := func(addr string, sats int64, direction string) {
+			stats, ok := addressStats[addr]
+			if !ok {
+				stats = &AddressStats{
+					transactionTypes: make(map[string]int),
+					dailyVolume:      make(map[string]float64),
+				}
+				addressStats[addr] = stats
+			}
+			value := float64(sats) / 100_000_000
+
+			// An address on both sides of one tx is still a single interaction
+			if stats.lastTxID == tx.TxID {
+				stats.amounts[len(stats.amounts)-1] += value
+			} else {
+				if !stats.lastSeen.IsZero() {
+					stats.timeDiffs = append(stats.timeDiffs, txTime.Sub(stats.lastSeen).Hours())
+				}
+				stats.totalTransactions++
+				stats.amounts = append(stats.amounts, value)
+			}
+			stats.totalVolume += value
+			stats.lastSeen = txTime
+			stats.lastTxID = tx.TxID
+			stats.transactionTypes[direction]++
+			stats.dailyVolume[txTime.Format("2006-01-02")] += value
+		}
+		for addr, sats := range spent {
+			record(addr, sats, "out")
+		}
+		for addr, sats := range received {
+			record(addr, sats, "in")
+		}
+	}
+
+	fmt.Printf("%s1. Suspicious Pattern Detection%s\n", Headers, Reset)
+
+	for addr, stats := range addressStats {
+		if addr == address {
+			continue
+		}
+
+		var mean, variance float64
+		for _, amount := range stats.amounts {
+			mean += amount
+		}
+		mean /= float64(len(stats.amounts))
+		for _, amount := range stats.amounts {
+			variance += math.Pow(amount-mean, 2)
+		}
+		variance /= float64(len(stats.amounts))
+		stdDev := math.Sqrt(variance)
+
+		if stdDev > UNUSUAL_VARIANCE_THRESHOLD && stats.totalTransactions > 3 {
+			unusualPatterns[addr] = append(unusualPatterns[addr],
+				fmt.Sprintf("High variance in transaction amounts (stdDev: %.2f BTC)", stdDev))
+		}
+
+		if stats.totalVolume > HIGH_VALUE_THRESHOLD && stats.totalTransactions < 3 {
+			unusualPatterns[addr] = append(unusualPatterns[addr], "High volume with few transactions")
+		}
+
+		if len(stats.timeDiffs) > 3 {
+			var avgTimeDiff float64
+			for _, diff := range stats.timeDiffs {
+				avgTimeDiff += diff
+			}
+			avgTimeDiff /= float64(len(stats.timeDiffs))
+			if avgTimeDiff < FREQUENT_INTERVAL {
+				unusualPatterns[addr] = append(unusualPatterns[addr],
+					fmt.Sprintf("Unusually frequent transactions (every %.1f minutes on average)", avgTimeDiff*60))
+			}
+		}
+
+		var days []string
+		for day := range stats.dailyVolume {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		for _, day := range days {
+			if stats.dailyVolume[day] > HIGH_VALUE_THRESHOLD && stats.totalTransactions > TEMPORAL_SPAM_THRESHOLD {
+				unusualPatterns[addr] = append(unusualPatterns[addr],
+					fmt.Sprintf("High volume on %s (%.8f BTC), possibly suspicious activity", day, stats.dailyVolume[day]))
+			}
+		}
+	}
+
+	var flagged []string
+	for addr := range unusualPatterns {
+		flagged = append(flagged, addr)
+	}
+	sort.Strings(flagged)
+
+	if len(flagged) > 0 {
+		fmt.Printf("\n%sDetected Suspicious Patterns:%s\n", Yellow, Reset)
+		for _, addr := range flagged {
+			patterns := unusualPatterns[addr]
+			for _, pattern := range patterns {
+				findings = append(findings, analysis.Finding{
+					ID: "patterns.counterparty", Severity: analysis.Medium, Message: pattern, Addresses: []string{addr},
+				})
+			}
+
+			fmt.Printf("Address: %s\n", labelAddress(addr))
+			for _, pattern := range patterns {
+				fmt.Printf("  - %s\n", pattern)
+			}
+
+			stats := addressStats[addr]
+			fmt.Printf("  Statistics:\n")
+			fmt.Printf("    - Total Transactions: %d\n", stats.totalTransactions)
+			fmt.Printf("    - Total Volume: %.8f BTC\n", stats.totalVolume)
+			fmt.Printf("    - Last Seen: %s\n", stats.lastSeen.Format("2006-01-02 15:04:05"))
+			fmt.Printf("    - Transaction Types: In: %d, Out: %d\n",
+				stats.transactionTypes["in"], stats.transactionTypes["out"])
+		}
+	} else {
+		fmt.Printf("- No suspicious counterparty patterns\n")
+	}
+
+	fmt.Printf("\n%s2. Temporal Analysis%s\n", Headers, Reset)
+	bursts := detectBursts(sorted, BURST_WINDOW, BURST_MIN_TXS)
+	if len(bursts) > 0 {
+		fmt.Printf("\n%sTransaction Bursts (%d+ transactions within %s):%s\n", Yellow, BURST_MIN_TXS, BURST_WINDOW, Reset)
+		for _, burst := range bursts {
+			findings = append(findings, analysis.Finding{
+				ID: "patterns.burst", Severity: analysis.Low, TxIDs: burst.TxIDs,
+				Message: fmt.Sprintf("%d transactions between %s and %s", len(burst.TxIDs),
+					burst.Start.Format("2006-01-02 15:04:05"), burst.End.Format("2006-01-02 15:04:05")),
+			})
+			fmt.Printf("- %s to %s: %d transactions (%s)\n",
+				burst.Start.Format("2006-01-02 15:04:05"), burst.End.Format("15:04:05"),
+				len(burst.TxIDs), strings.Join(burst.TxIDs, ", "))
+		}
+	} else {
+		fmt.Printf("- No transaction bursts\n")
+	}
+
+	fmt.Printf("\n%s3. Volume Analysis%s\n", Headers, Reset)
+	var highValueTxs []string
+	for _, tx := range sorted {
+		value := walletVolume(txDetails[tx.TxID])
+		if value > HIGH_VALUE_THRESHOLD {
+			highValueTxs = append(highValueTxs, fmt.Sprintf("TxID: %s, Amount: %.8f BTC", tx.TxID, value))
+		}
+	}
+	// Spikes are amounts well above the recent median, see anomaly.go
+	var spikeTransactions []string
+	for _, a := range amountAnomalies(sorted, txDetails) {
+		if a.Score > 0 {
+			spikeTransactions = append(spikeTransactions, fmt.Sprintf("TxID: %s, Amount: %.8f BTC (z-score %.1f)", a.TxID, a.Value, a.Score))
+		}
+	}
+
+	if len(highValueTxs) > 0 {
+		fmt.Printf("\n%sHigh-Value Transactions:%s\n", Yellow, Reset)
+		for _, tx := range highValueTxs {
+			fmt.Printf("- %s\n", tx)
+		}
+	}
+	if len(spikeTransactions) > 0 {
+		fmt.Printf("\n%sSpike Transactions:%s\n", Yellow, Reset)
+		for _, tx := range spikeTransactions {
+			fmt.Printf("- %s\n", tx)
+		}
+	}
+
+	fmt.Printf("\n%s4. Network Analysis%s\n", Headers, Reset)
+	var frequentInteractors []string
+	for addr, stats := range addressStats {
+		if addr != address && stats.totalTransactions > 4 {
+			frequentInteractors = append(frequentInteractors, addr)
+		}
+	}
+	sort.Slice(frequentInteractors, func(i, j int) bool {
+		return addressStats[frequentInteractors[i]].totalTransactions > addressStats[frequentInteractors[j]].totalTransactions
+	})
+
+	if len(frequentInteractors) > 0 {
+		fmt.Printf("\n%sFrequent Interactors:%s\n", Yellow, Reset)
+		for _, addr := range frequentInteractors {
+			stats := addressStats[addr]
+			fmt.Printf("Address: %s\n", labelAddress(addr))
+			fmt.Printf("  - Transaction Count: %d\n", stats.totalTransactions)
+			fmt.Printf("  - Total Volume: %.8f BTC\n", stats.totalVolume)
+		}
+	} else {
+		fmt.Printf("- No counterparty with more than 4 transactions\n")
+	}
+	return findings, Metrics{
+		"flagged_counterparties": float64(len(flagged)),
+		"tx_bursts":              float64(len(bursts)),
+		"high_value_txs":         float64(len(highValueTxs)),
+		"frequent_interactors":   float64(len(frequentInteractors)),
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDetectBursts(t *testing.T) {
+	// Minutes from the first tx
+	at := func(minutes ...int) []Transaction {
+		var txs []Transaction
+		for i, m := range minutes {
+			txs = append(txs, Transaction{TxID: fmt.Sprintf("tx%d", i), Time: 1_700_000_000 + m*60})
+		}
+		return txs
+	}
+	tests := []struct {
+		name   string
+		txs    []Transaction
+		bursts [][]string
+	}{
+		{"too few", at(0, 5), nil},
+		{"one burst", at(0, 5, 10, 15, 20), [][]string{{"tx0", "tx1", "tx2", "tx3", "tx4"}}},
+		{"overlapping windows merge", at(0, 30, 55, 80, 105), [][]string{{"tx0", "tx1", "tx2", "tx3", "tx4"}}},
+		{"quiet gap splits", at(0, 5, 10, 1440, 1445, 1450), [][]string{{"tx0", "tx1", "tx2"}, {"tx3", "tx4", "tx5"}}},
+		{"spread out", at(0, 120, 240, 360), nil},
+		{"unsorted input", at(1445, 0, 1440, 10, 5, 1450), [][]string{{"tx1", "tx4", "tx3"}, {"tx2", "tx0", "tx5"}}},
+	}
+	for _, tt := range tests {
+		bursts := detectBursts(tt.txs, time.Hour, 3)
+		if len(bursts) != len(tt.bursts) {
+			t.Errorf("%s: %d bursts, want %d (%+v)", tt.name, len(bursts), len(tt.bursts), bursts)
+			continue
+		}
+		for i, burst := range bursts {
+			if fmt.Sprint(burst.TxIDs) != fmt.Sprint(tt.bursts[i]) {
+				t.Errorf("%s: burst %d has %v, want %v", tt.name, i, burst.TxIDs, tt.bursts[i])
+			}
+			if burst.End.Before(burst.Start) {
+				t.Errorf("%s: burst %d ends before it starts", tt.name, i)
+			}
+		}
+	}
+}
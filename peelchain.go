@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+const (
+	PEEL_MAX_OUTPUTS = 3
+	PEEL_RATIO       = 0.25 // peeled amount relative to what carries on
+	MIN_PEEL_HOPS    = 3
+)
+
+type PeelHop struct {
+	TxID         string
+	Time         time.Time
+	Peeled       int64
+	Destinations []string
+	Remaining    int64
+	Pending      bool
+}
+
+// The change output carries on, the rest is peeled off and has to be
+// small next to it. The detected change is taken when there is one, the
+// largest output otherwise. Returns the index of the carrying output, or
+// -1 when the tx isn't peel shaped
+func peelShape(tx Transaction) int {
+	if len(tx.Out) < 2 || len(tx.Out) > PEEL_MAX_OUTPUTS {
+		return -1
+	}
+	carry := -1
+	for _, role := range detectChange(tx, "") {
+		if role.Change {
+			carry = role.Index
+		}
+	}
+	if carry < 0 {
+		carry = 0
+		for i, out := range tx.Out {
+			if out.Value > tx.Out[carry].Value {
+				carry = i
+			}
+		}
+	}
+
+	var peeled int64
+	for i, out := range tx.Out {
+		if i != carry {
+			peeled += out.Value
+		}
+	}
+	// An even split is a payment with change, not a peel
+	if float64(peeled) > PEEL_RATIO*float64(tx.Out[carry].Value) {
+		return -1
+	}
+	return carry
+}
+
+// Follows the carrying output forward from start until the shape breaks,
+// the coins are unspent or maxDepth hops were walked
+func tracePeelChain(fetcher analysis.Fetcher, start Transaction, maxDepth int) ([]PeelHop, string) {
+	tx := start
+	var hops []PeelHop
+	for len(hops) < maxDepth {
+		carry := peelShape(tx)
+		if carry < 0 {
+			return hops, fmt.Sprintf("%s is not peel shaped (%d outputs)", tx.TxID, len(tx.Out))
+		}
+
+		hop := PeelHop{
+			TxID:      tx.TxID,
+			Time:      time.Unix(int64(tx.Time), 0),
+			Remaining: tx.Out[carry].Value,
+			Pending:   tx.Pending(),
+		}
+		for i, out := range tx.Out {
+			if i == carry {
+				continue
+			}
+			hop.Peeled += out.Value
+			hop.Destinations = append(hop.Destinations, out.Addr)
+		}
+		hops = append(hops, hop)
+
+		next, err := fetcher.FetchOutspend(tx.Ref(), tx.Out[carry].N)
+		if err != nil {
+			return hops, fmt.Sprintf("lookup failed: %v", err)
+		}
+		if next == nil {
+			return hops, "remaining coins are unspent"
+		}
+		tx = *next
+	}
+	return hops, fmt.Sprintf("reached max depth of %d", maxDepth)
+}
+
+func printPeelChain(hops []PeelHop, stopReason string) {
+	if len(hops) == 0 {
+		fmt.Printf("- No peel hops: %s\n", stopReason)
+		return
+	}
+
+	var totalPeeled int64
+	for i, hop := range hops {
+		status := hop.Time.Format("2006-01-02 15:04:05")
+		if hop.Pending {
+			status = "unconfirmed"
+		}
+		fmt.Printf("%2d. %s (%s)\n", i+1, hop.TxID, status)
+		fmt.Printf("    peeled %.8f BTC to %s, %.8f BTC carried on\n",
+			float64(hop.Peeled)/100_000_000, formatAddresses(hop.Destinations, 2), float64(hop.Remaining)/100_000_000)
+		totalPeeled += hop.Peeled
+	}
+
+	fmt.Printf("- Hops: %d, Total Peeled: %.8f BTC (stopped: %s)\n", len(hops), float64(totalPeeled)/100_000_000, stopReason)
+	if len(hops) >= MIN_PEEL_HOPS {
+		fmt.Printf("%sPeel chain detected: %d consecutive peel transactions%s\n", Red, len(hops), Reset)
+	}
+}
+
+// Peel chain report for one txid
+func runPeelTrace(txid string, maxDepth int) error {
+	tx, err := backend.FetchTransaction(txid)
+	if err != nil {
+		return fmt.Errorf("failed to fetch transaction %s: %v", txid, err)
+	}
+
+	fmt.Printf("\n%s=== Peel Chain Trace from %s ===%s\n\n", Yellow, txid, Reset)
+	hops, reason := tracePeelChain(backend, *tx, maxDepth)
+	printPeelChain(hops, reason)
+	return nil
+}
+
+// Traces every peel shaped tx the watched address sent
+func analyzePeelChains(fetcher analysis.Fetcher, transactions []Transaction, address string, maxDepth int) ([]analysis.Finding, Metrics) {
+	var findings []analysis.Finding
+	metrics := Metrics{"peel_chains": 0, "longest_peel_chain": 0}
+	fmt.Printf("\n%s=== Peel Chain Analysis ===%s\n", Yellow, Reset)
+	var traced int
+	for _, tx := range transactions {
+		if !paidByWallet(tx, address) || peelShape(tx) < 0 {
+			continue
+		}
+		traced++
+		fmt.Printf("\n%sFrom %s:%s\n", Cyan, tx.TxID, Reset)
+		hops, reason := tracePeelChain(fetcher, tx, maxDepth)
+		printPeelChain(hops, reason)
+		metrics["longest_peel_chain"] = max(metrics["longest_peel_chain"], float64(len(hops)))
+
+		if len(hops) >= MIN_PEEL_HOPS {
+			metrics["peel_chains"]++
+			finding := analysis.Finding{
+				ID: "peel.chain", Severity: analysis.Medium,
+				Message: fmt.Sprintf("Peel chain of %d transactions starting at %s", len(hops), tx.TxID),
+			}
+			for _, hop := range hops {
+				finding.TxIDs = append(finding.TxIDs, hop.TxID)
+			}
+			findings = append(findings, finding)
+		}
+	}
+	if traced == 0 {
+		fmt.Printf("- No peel shaped transactions sent by this wallet\n")
+	}
+	return findings, metrics
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPeelShape(t *testing.T) {
+	tests := []struct {
+		name  string
+		tx    Transaction
+		carry int
+	}{
+		{
+			name:  "small round payment, change carries on",
+			tx:    testTx("a", 0, []testIO{{testSegwit, 100_000_000}}, []testIO{{testLegacy, 5_000_000}, {testSegwit, 94_999_000}}),
+			carry: 1,
+		},
+		{
+			name:  "no change detected, largest output carries on",
+			tx:    testTx("b", 0, []testIO{{testTaproot, 100_000_000}}, []testIO{{testLegacy, 12_345_678}, {testScript, 87_653_322}}),
+			carry: 1,
+		},
+		{
+			name:  "even split with detected change",
+			tx:    testTx("c", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 50_000_000}, {testSegwit, 49_999_000}}),
+			carry: -1,
+		},
+		{
+			name:  "payment larger than the detected change",
+			tx:    testTx("d", 0, []testIO{{testWatched, 100_000_000}}, []testIO{{testLegacy, 90_000_000}, {testSegwit, 9_999_000}}),
+			carry: -1,
+		},
+		{
+			name:  "no change detected, even split",
+			tx:    testTx("e", 0, []testIO{{testTaproot, 100_000_000}}, []testIO{{testLegacy, 45_678_901}, {testScript, 54_320_099}}),
+			carry: -1,
+		},
+		{
+			name:  "single output",
+			tx:    testTx("f", 0, []testIO{{testSegwit, 100_000_000}}, []testIO{{testLegacy, 99_999_000}}),
+			carry: -1,
+		},
+		{
+			name: "too many outputs",
+			tx: testTx("g", 0, []testIO{{testSegwit, 100_000_000}},
+				[]testIO{{testLegacy, 1_000_000}, {testScript, 1_000_000}, {testTaproot, 1_000_000}, {testSegwit, 96_999_000}}),
+			carry: -1,
+		},
+	}
+	for _, tt := range tests {
+		if carry := peelShape(tt.tx); carry != tt.carry {
+			t.Errorf("%s: carrying output %d, want %d", tt.name, carry, tt.carry)
+		}
+	}
+}
+
+// Each hop peels a round amount to testLegacy, the change goes on to testSegwit
+func testPeelChain(values ...int64) ([]Transaction, *testFetcher) {
+	fetcher := &testFetcher{outspends: make(map[string]Transaction)}
+	var chain []Transaction
+	remaining := int64(100_000_000)
+	for i, peeled := range values {
+		txid := string(rune('a' + i))
+		tx := testTx(txid, 1_700_000_000+i*600, []testIO{{testSegwit, remaining}}, []testIO{{testLegacy, peeled}, {testSegwit, remaining - peeled - 1_000}})
+		if i > 0 {
+			fetcher.outspends[chain[i-1].Outpoint(1)] = tx
+		}
+		chain = append(chain, tx)
+		remaining -= peeled + 1_000
+	}
+	return chain, fetcher
+}
+
+func TestTracePeelChain(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int64
+		depth  int
+		hops   int
+		reason string
+	}{
+		{"runs until the coins are unspent", []int64{5_000_000, 4_000_000, 3_000_000}, 10, 3, "unspent"},
+		{"stops at max depth", []int64{5_000_000, 4_000_000, 3_000_000}, 2, 2, "max depth"},
+		{"stops at an even split", []int64{5_000_000, 40_000_000, 3_000_000}, 10, 1, "not peel shaped"},
+	}
+	for _, tt := range tests {
+		chain, fetcher := testPeelChain(tt.values...)
+		hops, reason := tracePeelChain(fetcher, chain[0], tt.depth)
+		if len(hops) != tt.hops || !strings.Contains(reason, tt.reason) {
+			t.Errorf("%s: %d hops (%s), want %d (%s)", tt.name, len(hops), reason, tt.hops, tt.reason)
+			continue
+		}
+		for i, hop := range hops {
+			if hop.TxID != chain[i].TxID || hop.Peeled != tt.values[i] || hop.Remaining != chain[i].Out[1].Value {
+				t.Errorf("%s: hop %d is %+v", tt.name, i, hop)
+			}
+			if len(hop.Destinations) != 1 || hop.Destinations[0] != testLegacy {
+				t.Errorf("%s: hop %d peeled to %v, want %s", tt.name, i, hop.Destinations, testLegacy)
+			}
+		}
+	}
+}
+
+func TestAnalyzePeelChains(t *testing.T) {
+	chain, fetcher := testPeelChain(5_000_000, 4_000_000, 3_000_000)
+	// The wallet funds the first hop
+	chain[0].Inputs[0].PrevOut.Addr = testWatched
+
+	restore := silenceOutput()
+	findings, metrics := analyzePeelChains(fetcher, chain[:1], testWatched, 10)
+	restore()
+	if len(findings) != 1 || len(findings[0].TxIDs) != 3 {
+		t.Errorf("findings %+v, want one peel chain of 3 transactions", findings)
+	}
+	if metrics["peel_chains"] != 1 || metrics["longest_peel_chain"] != 3 {
+		t.Errorf("metrics %v, want 1 chain of 3 hops", metrics)
+	}
+}
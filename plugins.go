@@ -0,0 +1,7 @@
+package main
+
+// Analyzers from other packages register themselves on import. Add a
+// blank import here to link one in
+import (
+	_ "crypto_tracker/analysis/reuse"
+)
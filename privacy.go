@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+const (
+	QUICK_SPEND_WINDOW = time.Hour // spending coins this soon after receiving them links both txs
+	GOOD_PRIVACY_SCORE = 80
+	FAIR_PRIVACY_SCORE = 50
+)
+
+// One privacy leak and the txs that caused it. Each occurrence costs
+// Penalty points, up to MaxPenalty for the whole check
+type PrivacyCheck struct {
+	ID         string
+	Title      string
+	Penalty    int
+	MaxPenalty int
+	Details    []string
+	TxIDs      []string
+}
+
+func (c *PrivacyCheck) add(txid, detail string) {
+	c.TxIDs = append(c.TxIDs, txid)
+	c.Details = append(c.Details, detail)
+}
+
+func (c *PrivacyCheck) Cost() int {
+	return min(c.Penalty*len(c.TxIDs), c.MaxPenalty)
+}
+
+type PrivacyReport struct {
+	Score  int // 100 = nothing leaked in the fetched history
+	Checks []*PrivacyCheck
+}
+
+func (r PrivacyReport) Grade() string {
+	switch {
+	case r.Score >= GOOD_PRIVACY_SCORE:
+		return "GOOD"
+	case r.Score >= FAIR_PRIVACY_SCORE:
+		return "FAIR"
+	default:
+		return "POOR"
+	}
+}
+
+// Sender entity of a tx, the cluster of its first input
+func senderCluster(tx Transaction, clusters *Clusters) string {
+	for _, in := range tx.Inputs {
+		if in.PrevOut.Addr != "" {
+			return clusters.Find(in.PrevOut.Addr)
+		}
+	}
+	return ""
+}
+
+func buildPrivacyReport(transactions []Transaction, address string, clusters *Clusters) PrivacyReport {
+	reuse := &PrivacyCheck{ID: "privacy.address-reuse", Title: "Address reuse", Penalty: 3, MaxPenalty: 25}
+	round := &PrivacyCheck{ID: "privacy.round-payment", Title: "Round-number payments", Penalty: 5, MaxPenalty: 15}
+	scripts := &PrivacyCheck{ID: "privacy.script-mixing", Title: "Script-type mixing", Penalty: 5, MaxPenalty: 15}
+	merges := &PrivacyCheck{ID: "privacy.utxo-merge", Title: "Merged UTXOs from unrelated sources", Penalty: 10, MaxPenalty: 25}
+	timing := &PrivacyCheck{ID: "privacy.timing", Title: "Timing correlation", Penalty: 5, MaxPenalty: 20}
+
+	// Funding tx of every output the address received
+	fundedBy := make(map[string]Transaction)
+	for _, tx := range transactions {
+		for _, out := range tx.Out {
+			if out.Addr == address {
+				fundedBy[tx.Outpoint(out.N)] = tx
+			}
+		}
+	}
+
+	uses := 0
+	for _, tx := range sortedByTime(transactions) {
+		receivesHere := false
+		for _, out := range tx.Out {
+			receivesHere = receivesHere || out.Addr == address
+		}
+		if receivesHere {
+			uses++
+			if uses > 1 {
+				reason := "received another payment from " + formatAddresses(senderAddresses(tx, address), 1)
+				if paidByWallet(tx, address) {
+					reason = "change sent back to the same address"
+				}
+				reuse.add(tx.TxID, fmt.Sprintf("%s: %s (use %d)", tx.TxID, reason, uses))
+			}
+		}
+
+		if !paidByWallet(tx, address) {
+			continue
+		}
+		roles := detectChange(tx, address)
+
+		var change *OutputRole
+		for i := range roles {
+			if roles[i].Change {
+				change = &roles[i]
+			}
+		}
+		if change != nil && change.Value%roundAmountUnit != 0 {
+			for _, role := range roles {
+				if !role.Change && role.Value%roundAmountUnit == 0 {
+					round.add(tx.TxID, fmt.Sprintf("%s: paid a round %.8f BTC to %s, so the other output is obviously change",
+						tx.TxID, float64(role.Value)/100_000_000, labelAddress(role.Addr)))
+					break
+				}
+			}
+		}
+
+		inputTypes := make(map[AddressType]bool)
+		for _, in := range tx.Inputs {
+			inputTypes[addressType(in.PrevOut.Addr)] = true
+		}
+		switch {
+		case len(inputTypes) > 1:
+			scripts.add(tx.TxID, fmt.Sprintf("%s: spends %d different input script types", tx.TxID, len(inputTypes)))
+		case change != nil && !inputTypes[addressType(change.Addr)]:
+			scripts.add(tx.TxID, fmt.Sprintf("%s: change is %s but the inputs are not", tx.TxID, addressType(change.Addr)))
+		case change != nil:
+			for _, role := range roles {
+				if !role.Change && addressType(role.Addr) != addressType(change.Addr) {
+					scripts.add(tx.TxID, fmt.Sprintf("%s: only the change matches the input script type (%s)",
+						tx.TxID, addressType(change.Addr)))
+					break
+				}
+			}
+		}
+
+		sources := make(map[string]bool)
+		var quickest time.Duration = -1
+		for _, in := range tx.Inputs {
+			funding, ok := fundedBy[in.Outpoint()]
+			if !ok {
+				continue
+			}
+			if root := senderCluster(funding, clusters); root != "" && root != clusters.Find(address) {
+				sources[root] = true
+			}
+			held := time.Duration(int64(tx.Time)-int64(funding.Time)) * time.Second
+			if funding.Time > 0 && tx.Time >= funding.Time && (quickest < 0 || held < quickest) {
+				quickest = held
+			}
+		}
+		if len(sources) > 1 {
+			merges.add(tx.TxID, fmt.Sprintf("%s: merges coins received from %d unrelated senders, linking them together",
+				tx.TxID, len(sources)))
+		}
+		if quickest >= 0 && quickest < QUICK_SPEND_WINDOW {
+			timing.add(tx.TxID, fmt.Sprintf("%s: spent coins %s after receiving them", tx.TxID, quickest.Round(time.Minute)))
+		}
+	}
+
+	report := PrivacyReport{Score: 100, Checks: []*PrivacyCheck{reuse, round, scripts, merges, timing}}
+	for _, check := range report.Checks {
+		report.Score -= check.Cost()
+	}
+	report.Score = max(report.Score, 0)
+	return report
+}
+
+func analyzePrivacy(transactions []Transaction, address string, clusters *Clusters) ([]analysis.Finding, Metrics) {
+	report := buildPrivacyReport(transactions, address, clusters)
+
+	fmt.Printf("\n%s=== Privacy Report ===%s\n\n", Yellow, Reset)
+	color := Green
+	switch report.Grade() {
+	case "FAIR":
+		color = Yellow
+	case "POOR":
+		color = Red
+	}
+	fmt.Printf("%sPrivacy score: %d/100 (%s)%s\n", color, report.Score, report.Grade(), Reset)
+
+	var findings []analysis.Finding
+	for _, check := range report.Checks {
+		if len(check.TxIDs) == 0 {
+			fmt.Printf("\n%s%s:%s none\n", Cyan, check.Title, Reset)
+			continue
+		}
+		fmt.Printf("\n%s%s: %d (-%d points)%s\n", Cyan, check.Title, len(check.TxIDs), check.Cost(), Reset)
+		for _, detail := range check.Details {
+			fmt.Printf("- %s\n", detail)
+		}
+		findings = append(findings, analysis.Finding{
+			ID: check.ID, Severity: analysis.Low, TxIDs: check.TxIDs,
+			Message: fmt.Sprintf("%s in %d transactions costs %d privacy points", check.Title, len(check.TxIDs), check.Cost()),
+		})
+	}
+
+	findings = append(findings, analysis.Finding{
+		ID: "privacy.score", Severity: analysis.Info,
+		Message: fmt.Sprintf("Privacy score %d/100 (%s)", report.Score, report.Grade()),
+	})
+	return findings, Metrics{"privacy_score": float64(report.Score)}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPrivacyCheckCost(t *testing.T) {
+	check := &PrivacyCheck{Penalty: 5, MaxPenalty: 12}
+	for i, cost := range []int{0, 5, 10, 12, 12} {
+		if got := check.Cost(); got != cost {
+			t.Errorf("%d occurrences: cost %d, want %d", i, got, cost)
+		}
+		check.add(fmt.Sprintf("tx%d", i), "")
+	}
+}
+
+func TestPrivacyGrade(t *testing.T) {
+	tests := []struct {
+		score int
+		grade string
+	}{
+		{100, "GOOD"},
+		{GOOD_PRIVACY_SCORE, "GOOD"},
+		{GOOD_PRIVACY_SCORE - 1, "FAIR"},
+		{FAIR_PRIVACY_SCORE, "FAIR"},
+		{FAIR_PRIVACY_SCORE - 1, "POOR"},
+		{0, "POOR"},
+	}
+	for _, tt := range tests {
+		if got := (PrivacyReport{Score: tt.score}).Grade(); got != tt.grade {
+			t.Errorf("score %d: %s, want %s", tt.score, got, tt.grade)
+		}
+	}
+}
+
+// Payments from two unrelated senders, merged ten minutes after the second
+// one arrived into a round payment with change back to the same address
+func testPrivacyHistory() []Transaction {
+	const day = 86_400
+	in1 := testTx("in1", 1_700_000_000, []testIO{{testLegacy, 10_001_000}}, []testIO{{testWatched, 10_000_000}})
+	in2 := testTx("in2", 1_700_000_000+day, []testIO{{testScript, 5_001_000}}, []testIO{{testWatched, 5_000_000}})
+	spend := testTx("spend", 1_700_000_000+day+600, []testIO{{testWatched, 10_000_000}, {testWatched, 5_000_000}},
+		[]testIO{{testTaproot, 12_000_000}, {testWatched, 2_999_000}})
+	testSpend(&spend, 0, in1, 0)
+	testSpend(&spend, 1, in2, 0)
+	return []Transaction{spend, in2, in1}
+}
+
+func TestBuildPrivacyReport(t *testing.T) {
+	tests := []struct {
+		name   string
+		txs    []Transaction
+		counts map[string]int
+		score  int
+	}{
+		{
+			name:  "single payment received",
+			txs:   testPrivacyHistory()[2:],
+			score: 100,
+		},
+		{
+			name:   "second payment to the same address",
+			txs:    testPrivacyHistory()[1:],
+			counts: map[string]int{"privacy.address-reuse": 1},
+			score:  97,
+		},
+		{
+			name: "every leak",
+			txs:  testPrivacyHistory(),
+			counts: map[string]int{
+				"privacy.address-reuse": 2, "privacy.round-payment": 1, "privacy.script-mixing": 1,
+				"privacy.utxo-merge": 1, "privacy.timing": 1,
+			},
+			score: 69,
+		},
+	}
+	for _, tt := range tests {
+		report := buildPrivacyReport(tt.txs, testWatched, buildClusters(tt.txs))
+		for _, check := range report.Checks {
+			if len(check.TxIDs) != tt.counts[check.ID] {
+				t.Errorf("%s: %s in %v, want %d txs", tt.name, check.ID, check.Details, tt.counts[check.ID])
+			}
+		}
+		if report.Score != tt.score {
+			t.Errorf("%s: score %d, want %d", tt.name, report.Score, tt.score)
+		}
+	}
+}
+
+func TestBuildPrivacyReportCapped(t *testing.T) {
+	// Repeats hit each check's cap, together they take all 100 points
+	var txs []Transaction
+	for i := 0; i < 10; i++ {
+		txs = append(txs, testPrivacyHistory()...)
+	}
+	if report := buildPrivacyReport(txs, testWatched, buildClusters(txs)); report.Score != 0 {
+		t.Errorf("score %d, want 0 with every check capped", report.Score)
+	}
+}
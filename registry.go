@@ -0,0 +1,478 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+// Address flagged by one of the analyzers during a run
+type SuspiciousFlag struct {
+	Address string
+	Reason  string
+}
+
+// Flags collected by the analyzers, saved to the registry at the end of a run
+var Suspiciouswallets []SuspiciousFlag
+
+func flagSuspicious(address, reason string) {
+	Suspiciouswallets = append(Suspiciouswallets, SuspiciousFlag{Address: address, Reason: reason})
+}
+
+type RegistryEntry struct {
+	Address      string
+	Status       string // active or dismissed
+	Note         string
+	FirstFlagged time.Time
+	LastFlagged  time.Time
+	LastChecked  time.Time
+	Flags        []RegistryFlag
+}
+
+type RegistryFlag struct {
+	Reason       string
+	SourceWallet string
+	FirstFlagged time.Time
+	LastFlagged  time.Time
+}
+
+func initRegistryTables(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS suspicious_wallets (
+            address      TEXT PRIMARY KEY,
+            status       TEXT NOT NULL DEFAULT 'active',
+            note         TEXT NOT NULL DEFAULT '',
+            last_checked INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE TABLE IF NOT EXISTS suspicious_flags (
+            address       TEXT NOT NULL,
+            reason        TEXT NOT NULL,
+            source_wallet TEXT NOT NULL,
+            first_flagged INTEGER NOT NULL,
+            last_flagged  INTEGER NOT NULL,
+            PRIMARY KEY (address, reason, source_wallet)
+        );`)
+	return err
+}
+
+// Stores flags raised while analysing sourceWallet. Dismissed entries
+// keep their status, the new flag is still recorded against them
+func saveSuspiciousFlags(db *sql.DB, sourceWallet string, flags []SuspiciousFlag) error {
+	if err := initRegistryTables(db); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, f := range flags {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO suspicious_wallets (address) VALUES (?)`, f.Address); err != nil {
+			return err
+		}
+		_, err := db.Exec(`
+            INSERT INTO suspicious_flags (address, reason, source_wallet, first_flagged, last_flagged)
+            VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT (address, reason, source_wallet) DO UPDATE SET last_flagged = excluded.last_flagged`,
+			f.Address, f.Reason, sourceWallet, now, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadRegistry(db *sql.DB, includeDismissed bool) ([]RegistryEntry, error) {
+	if err := initRegistryTables(db); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT address, status, note, last_checked FROM suspicious_wallets`
+	if !includeDismissed {
+		query += ` WHERE status = 'active'`
+	}
+	rows, err := db.Query(query + ` ORDER BY address`)
+	if err != nil {
+		return nil, err
+	}
+	var entries []RegistryEntry
+	for rows.Next() {
+		var entry RegistryEntry
+		var checked int64
+		if err := rows.Scan(&entry.Address, &entry.Status, &entry.Note, &checked); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if checked > 0 {
+			entry.LastChecked = time.Unix(checked, 0)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	for i := range entries {
+		rows, err := db.Query(`SELECT reason, source_wallet, first_flagged, last_flagged FROM suspicious_flags WHERE address = ? ORDER BY last_flagged DESC`, entries[i].Address)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var f RegistryFlag
+			var first, last int64
+			if err := rows.Scan(&f.Reason, &f.SourceWallet, &first, &last); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			f.FirstFlagged, f.LastFlagged = time.Unix(first, 0), time.Unix(last, 0)
+			if entries[i].FirstFlagged.IsZero() || f.FirstFlagged.Before(entries[i].FirstFlagged) {
+				entries[i].FirstFlagged = f.FirstFlagged
+			}
+			if f.LastFlagged.After(entries[i].LastFlagged) {
+				entries[i].LastFlagged = f.LastFlagged
+			}
+			entries[i].Flags = append(entries[i].Flags, f)
+		}
+		rows.Close()
+	}
+	return entries, nil
+}
+
+func updateRegistryEntry(db *sql.DB, address, column, value string) error {
+	if err := initRegistryTables(db); err != nil {
+		return err
+	}
+	// column is never user input
+	result, err := db.Exec(`UPDATE suspicious_wallets SET `+column+` = ? WHERE address = ?`, value, address)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%s is not in the registry", address)
+	}
+	return nil
+}
+
+// Analyzers whose flagged counterparties are saved whatever the severity,
+// that is what they look for
+var registryAnalyzers = map[string]bool{"patterns": true, "behavior": true}
+
+// What a run saves to the registry: counterparties flagged by the pattern
+// analyzers, and those named in high or critical findings of any other
+func registryFlags(findings []analysis.Finding, address string) []SuspiciousFlag {
+	var flags []SuspiciousFlag
+	for _, f := range findings {
+		if f.Severity < analysis.High && !registryAnalyzers[f.Analyzer] {
+			continue
+		}
+		for _, addr := range f.Addresses {
+			if addr != address {
+				flags = append(flags, SuspiciousFlag{addr, f.Message})
+			}
+		}
+	}
+	return flags
+}
+
+// Screening and mixing checks on an address's own history
+func ownHistoryFlags(db *sql.DB, address string) ([]SuspiciousFlag, error) {
+	wallet, err := backend.FetchWallet(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags []SuspiciousFlag
+	listed, err := lookupBlocklist(db, []string{address})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range listed[address] {
+		flags = append(flags, SuspiciousFlag{address, "On blocklist " + entry.List})
+	}
+	matches, err := screenTransactions(db, wallet.Transactions, address, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range matches {
+		flags = append(flags, SuspiciousFlag{address, "Transacts with blocklisted " + match.Entry.Address + " (" + match.Entry.List + ")"})
+	}
+	for _, tx := range wallet.Transactions {
+		if match := detectCoinJoin(tx); match != nil {
+			flags = append(flags, SuspiciousFlag{address, "Takes part in " + match.String()})
+		}
+	}
+	return flags, nil
+}
+
+// One pass over the registry. Source wallets are analysed at most once
+// per pass, several entries usually share one
+type registryRecheck struct {
+	db        *sql.DB
+	analyzers []analysis.Analyzer
+	sources   map[string][]SuspiciousFlag
+	failed    map[string]error
+}
+
+// Reruns the analysis of a source wallet quietly and returns the flags a
+// regular run of it would save
+func (r *registryRecheck) sourceFlags(source string) ([]SuspiciousFlag, error) {
+	if flags, ok := r.sources[source]; ok {
+		return flags, nil
+	}
+	if err, ok := r.failed[source]; ok {
+		return nil, err
+	}
+	flags, err := r.analyze(source)
+	if err != nil {
+		r.failed[source] = err
+		return nil, err
+	}
+	r.sources[source] = flags
+	return flags, nil
+}
+
+func (r *registryRecheck) analyze(source string) ([]SuspiciousFlag, error) {
+	wallet, err := backend.FetchWallet(source)
+	if err != nil {
+		return nil, err
+	}
+	screening, err := screenTransactions(r.db, wallet.Transactions, source, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	restore := silenceOutput()
+	defer restore()
+	clusters := buildClusters(wallet.Transactions)
+	details := buildTransactionDetails(r.db, wallet, source)
+	state := &runState{db: r.db, clusters: clusters, screening: screening, readOnly: true}
+	ctx := &analysis.Context{Address: source, Transactions: wallet.Transactions, Details: details, Fetcher: backend, State: state}
+	findings := append(screeningFindings(screening), runAnalyzers(r.analyzers, ctx)...)
+	return registryFlags(findings, source), nil
+}
+
+type RecheckResult struct {
+	Confirmed []RegistryFlag
+	Cleared   []RegistryFlag
+	Added     []RegistryFlag
+}
+
+// Checks every flag of an entry again. A flag is confirmed when its source
+// wallet's analysis or the address's own history still raises it, and
+// cleared when neither does. Flags whose source can't be fetched are left
+// alone. New findings on the address's own history are recorded against
+// the wallet that first flagged it
+func (r *registryRecheck) entry(entry RegistryEntry) (RecheckResult, error) {
+	var result RecheckResult
+	own, err := ownHistoryFlags(r.db, entry.Address)
+	if err != nil {
+		return result, err
+	}
+	ownReasons := make(map[string]bool)
+	for _, f := range own {
+		ownReasons[f.Reason] = true
+	}
+
+	// Flags saved by older versions under "recheck" can only be confirmed
+	// by the own history checks
+	original := entry.Address
+	var firstFlagged time.Time
+	known := make(map[string]bool)
+	for _, f := range entry.Flags {
+		known[f.Reason] = true
+		if f.SourceWallet != "recheck" && (firstFlagged.IsZero() || f.FirstFlagged.Before(firstFlagged)) {
+			original, firstFlagged = f.SourceWallet, f.FirstFlagged
+		}
+	}
+
+	now := time.Now()
+	for _, f := range entry.Flags {
+		raised := ownReasons[f.Reason]
+		if !raised && f.SourceWallet != "recheck" {
+			flags, err := r.sourceFlags(f.SourceWallet)
+			if err != nil {
+				log.Printf("Error re-analysing %s: %v", f.SourceWallet, err)
+				continue
+			}
+			for _, sf := range flags {
+				raised = raised || (sf.Address == entry.Address && sf.Reason == f.Reason)
+			}
+		}
+
+		if raised {
+			if err := saveSuspiciousFlags(r.db, f.SourceWallet, []SuspiciousFlag{{entry.Address, f.Reason}}); err != nil {
+				return result, err
+			}
+			f.LastFlagged = now
+			result.Confirmed = append(result.Confirmed, f)
+			continue
+		}
+		_, err := r.db.Exec(`DELETE FROM suspicious_flags WHERE address = ? AND reason = ? AND source_wallet = ?`,
+			entry.Address, f.Reason, f.SourceWallet)
+		if err != nil {
+			return result, err
+		}
+		result.Cleared = append(result.Cleared, f)
+	}
+
+	var added []SuspiciousFlag
+	for _, f := range own {
+		if !known[f.Reason] {
+			known[f.Reason] = true
+			added = append(added, f)
+			result.Added = append(result.Added, RegistryFlag{Reason: f.Reason, SourceWallet: original, FirstFlagged: now, LastFlagged: now})
+		}
+	}
+	if err := saveSuspiciousFlags(r.db, original, added); err != nil {
+		return result, err
+	}
+	_, err = r.db.Exec(`UPDATE suspicious_wallets SET last_checked = ? WHERE address = ?`, now.Unix(), entry.Address)
+	return result, err
+}
+
+// Re-checks the active entries, or only the one named, dismissed or not
+func recheckRegistry(db *sql.DB, only string, analyzers []analysis.Analyzer) {
+	entries, err := loadRegistry(db, only != "")
+	if err != nil {
+		log.Printf("Error loading registry: %v", err)
+		return
+	}
+	r := &registryRecheck{db: db, analyzers: analyzers, sources: make(map[string][]SuspiciousFlag), failed: make(map[string]error)}
+	found := false
+	for _, entry := range entries {
+		if only != "" && entry.Address != only {
+			continue
+		}
+		found = true
+		result, err := r.entry(entry)
+		if err != nil {
+			log.Printf("Error re-checking %s: %v", entry.Address, err)
+			continue
+		}
+
+		status := ""
+		if entry.Status == "dismissed" {
+			status = " [dismissed]"
+		}
+		fmt.Printf("- %s%s: %d confirmed, %d new, %d cleared\n",
+			entry.Address, status, len(result.Confirmed), len(result.Added), len(result.Cleared))
+		for _, f := range result.Confirmed {
+			fmt.Printf("  - %s (from %s)\n", f.Reason, f.SourceWallet)
+		}
+		for _, f := range result.Added {
+			fmt.Printf("  %s- New: %s (from %s)%s\n", Red, f.Reason, f.SourceWallet, Reset)
+		}
+		for _, f := range result.Cleared {
+			fmt.Printf("  %s- Cleared: %s (from %s)%s\n", Green, f.Reason, f.SourceWallet, Reset)
+		}
+		if len(result.Confirmed)+len(result.Added) == 0 && entry.Status != "dismissed" {
+			fmt.Printf("  Nothing flags it any more, see: registry dismiss -address %s\n", entry.Address)
+		}
+	}
+	if only != "" && !found {
+		fmt.Printf("%s is not in the registry\n", only)
+	}
+}
+
+func printRegistry(entries []RegistryEntry) {
+	if len(entries) == 0 {
+		fmt.Println("Registry is empty")
+		return
+	}
+	for _, entry := range entries {
+		color := Red
+		if entry.Status == "dismissed" {
+			color = Reset
+		}
+		fmt.Printf("%s%s%s [%s]\n", color, labelAddress(entry.Address), Reset, entry.Status)
+		fmt.Printf("  First Flagged: %s, Last Flagged: %s\n",
+			entry.FirstFlagged.Format("2006-01-02 15:04:05"), entry.LastFlagged.Format("2006-01-02 15:04:05"))
+		if !entry.LastChecked.IsZero() {
+			fmt.Printf("  Last Re-checked: %s\n", entry.LastChecked.Format("2006-01-02 15:04:05"))
+		}
+		if entry.Note != "" {
+			fmt.Printf("  Note: %s\n", entry.Note)
+		}
+		for _, f := range entry.Flags {
+			fmt.Printf("  - %s (from %s)\n", f.Reason, f.SourceWallet)
+		}
+	}
+}
+
+func runRegistry(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: registry list|annotate|dismiss|recheck|watch ...")
+	}
+
+	fs := flag.NewFlagSet("registry "+args[0], flag.ExitOnError)
+	address := fs.String("address", "", "Registry address")
+	note := fs.String("note", "", "Note to attach")
+	all := fs.Bool("all", false, "Include dismissed entries")
+	interval := fs.Duration("interval", 6*time.Hour, "Time between re-checks for watch")
+	analyzerList := fs.String("analyzers", "default", "Analyzers re-run on source wallets by recheck and watch")
+	rulesPath := fs.String("risk-rules", "", "YAML file with risk scoring rules (see: rules)")
+	common := addCommonFlags(fs)
+	fs.Parse(args[1:])
+	common.apply()
+
+	analyzers, err := parseAnalyzers(*analyzerList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if riskRules, err = loadRiskRules(*rulesPath); err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if store, err := loadLabels(db); err == nil {
+		labels = store
+	}
+
+	switch args[0] {
+	case "list":
+		entries, err := loadRegistry(db, *all)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printRegistry(entries)
+
+	case "annotate":
+		if *address == "" || *note == "" {
+			log.Fatal("Usage: registry annotate -address <address> -note <text>")
+		}
+		if err := updateRegistryEntry(db, *address, "note", *note); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Annotated %s\n", *address)
+
+	case "dismiss":
+		if *address == "" {
+			log.Fatal("Usage: registry dismiss -address <address> [-note <reason>]")
+		}
+		if err := updateRegistryEntry(db, *address, "status", "dismissed"); err != nil {
+			log.Fatal(err)
+		}
+		if *note != "" {
+			if err := updateRegistryEntry(db, *address, "note", *note); err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("Dismissed %s\n", *address)
+
+	case "recheck":
+		recheckRegistry(db, *address, analyzers)
+
+	case "watch":
+		fmt.Printf("Re-checking active registry entries every %s\n", *interval)
+		for {
+			fmt.Printf("\n%s=== Registry Re-check %s ===%s\n", Headers, time.Now().Format("2006-01-02 15:04:05"), Reset)
+			recheckRegistry(db, *address, analyzers)
+			time.Sleep(*interval)
+		}
+
+	default:
+		log.Fatalf("Unknown registry command %q", args[0])
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"crypto_tracker/analysis"
+)
+
+func TestRegistryFlags(t *testing.T) {
+	findings := []analysis.Finding{
+		{Analyzer: "patterns", ID: "patterns.counterparty", Severity: analysis.Medium, Message: "regular payments", Addresses: []string{testLegacy}},
+		{Analyzer: "behavior", ID: "behavior.high-frequency", Severity: analysis.Medium, Message: "busy", Addresses: []string{testScript, testWatched}},
+		{Analyzer: "flows", ID: "flows.exchange", Severity: analysis.Medium, Message: "to an exchange", Addresses: []string{testSegwit}},
+		{Analyzer: "dust", ID: "dust.poisoning", Severity: analysis.High, Message: "poisoning", Addresses: []string{testTaproot}},
+		{Analyzer: "patterns", ID: "patterns.burst", Severity: analysis.Low, Message: "burst", TxIDs: []string{"a"}},
+	}
+	want := []SuspiciousFlag{
+		{testLegacy, "regular payments"},
+		{testScript, "busy"},
+		{testTaproot, "poisoning"},
+	}
+
+	flags := registryFlags(findings, testWatched)
+	if len(flags) != len(want) {
+		t.Fatalf("flags %v, want %v", flags, want)
+	}
+	for i := range want {
+		if flags[i] != want[i] {
+			t.Errorf("flag %d: %v, want %v", i, flags[i], want[i])
+		}
+	}
+}
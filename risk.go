@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"crypto_tracker/analysis"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules used when no -risk-rules file is given. Run "rules" to print them
+// as a starting point for your own file
+const defaultRiskRules = `rules:
+  - id: blocklisted-counterparty
+    metric: blocklist_matches
+    operator: ">"
+    threshold: 0
+    weight: 25
+    severity: critical
+    description: Interacts with blocklisted addresses
+  - id: mixing-exposure
+    metric: coinjoin_count
+    operator: ">"
+    threshold: 0
+    weight: 25
+    severity: medium
+    description: Mixing exposure through CoinJoin transactions
+  - id: high-frequency-counterparties
+    metric: high_frequency_counterparties
+    operator: ">"
+    threshold: 0
+    weight: 25
+    severity: medium
+    description: High frequency trading patterns detected
+  - id: daily-volume-spike
+    metric: max_daily_volume_btc
+    operator: ">"
+    threshold: 5
+    weight: 25
+    severity: medium
+    description: Large daily volume spikes
+  - id: transaction-frequency
+    metric: tx_per_day
+    operator: ">"
+    threshold: 10
+    weight: 25
+    severity: medium
+    description: Unusually high transaction frequency
+`
+
+// Numbers an analyzer computed, by metric name. Rules test them
+type Metrics map[string]float64
+
+type RiskRule struct {
+	ID          string  `yaml:"id"`
+	Metric      string  `yaml:"metric"`
+	Operator    string  `yaml:"operator"`
+	Threshold   float64 `yaml:"threshold"`
+	Weight      float64 `yaml:"weight"`
+	Severity    string  `yaml:"severity"` // low, medium, high or critical
+	Description string  `yaml:"description"`
+}
+
+type RiskRuleSet struct {
+	Rules []RiskRule `yaml:"rules"`
+}
+
+// Rule that fired, with the value that made it fire
+type RiskHit struct {
+	Rule  RiskRule
+	Value float64
+}
+
+type RiskAssessment struct {
+	Score     int // 0-100, share of the total rule weight that fired
+	Level     string
+	Hits      []RiskHit
+	Skipped   []string // rules whose metric no analyzer reported
+	Evaluated int
+}
+
+// Loaded in main from -risk-rules
+var riskRules []RiskRule
+
+var riskOperators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+func parseRiskRules(data []byte) ([]RiskRule, error) {
+	var set RiskRuleSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse risk rules: %v", err)
+	}
+	for i, rule := range set.Rules {
+		if rule.ID == "" {
+			set.Rules[i].ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Metric == "" {
+			return nil, fmt.Errorf("risk rule %s has no metric", set.Rules[i].ID)
+		}
+		if _, ok := riskOperators[rule.Operator]; !ok {
+			return nil, fmt.Errorf("risk rule %s has unknown operator %q", set.Rules[i].ID, rule.Operator)
+		}
+		// Stored lower case so "Critical" pins the score like "critical"
+		if rule.Severity == "" {
+			set.Rules[i].Severity = "medium"
+		} else if severity, err := analysis.ParseSeverity(rule.Severity); err != nil {
+			return nil, fmt.Errorf("risk rule %s: %v", set.Rules[i].ID, err)
+		} else {
+			set.Rules[i].Severity = severity.String()
+		}
+		if rule.Weight < 0 {
+			return nil, fmt.Errorf("risk rule %s has a negative weight", set.Rules[i].ID)
+		}
+	}
+	return set.Rules, nil
+}
+
+// Rules from path, or the built-in ones when path is empty
+func loadRiskRules(path string) ([]RiskRule, error) {
+	if path == "" {
+		return parseRiskRules([]byte(defaultRiskRules))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read risk rules: %v", err)
+	}
+	return parseRiskRules(data)
+}
+
+// Runs every rule against the metrics the analyzers computed. Rules on
+// metrics that weren't computed are skipped and left out of the score
+func evaluateRisk(rules []RiskRule, metrics Metrics) RiskAssessment {
+	var assessment RiskAssessment
+	var totalWeight, firedWeight float64
+	critical := false
+
+	for _, rule := range rules {
+		value, ok := metrics[rule.Metric]
+		if !ok {
+			assessment.Skipped = append(assessment.Skipped, fmt.Sprintf("%s (%s not computed, see: rules metrics)", rule.ID, rule.Metric))
+			continue
+		}
+		assessment.Evaluated++
+		totalWeight += rule.Weight
+		if !riskOperators[rule.Operator](value, rule.Threshold) {
+			continue
+		}
+		firedWeight += rule.Weight
+		critical = critical || rule.Severity == "critical"
+		assessment.Hits = append(assessment.Hits, RiskHit{Rule: rule, Value: value})
+	}
+
+	if totalWeight > 0 {
+		assessment.Score = int(100*firedWeight/totalWeight + 0.5)
+	}
+	// A critical rule pins the score regardless of weights
+	if critical {
+		assessment.Score = 100
+	}
+	sort.SliceStable(assessment.Hits, func(i, j int) bool {
+		return assessment.Hits[i].Rule.Weight > assessment.Hits[j].Rule.Weight
+	})
+
+	switch {
+	case critical:
+		assessment.Level = "CRITICAL"
+	case assessment.Score >= 50:
+		assessment.Level = "HIGH"
+	case assessment.Score > 0:
+		assessment.Level = "MEDIUM"
+	default:
+		assessment.Level = "LOW"
+	}
+	return assessment
+}
+
+func printRiskAssessment(assessment RiskAssessment) {
+	color := Green
+	switch assessment.Level {
+	case "CRITICAL", "HIGH":
+		color = Red
+	case "MEDIUM":
+		color = Yellow
+	}
+	fmt.Printf("%s%s RISK - score %d/100 (%d of %d rules triggered)%s\n",
+		color, assessment.Level, assessment.Score, len(assessment.Hits), assessment.Evaluated, Reset)
+
+	for _, hit := range assessment.Hits {
+		fmt.Printf("- [%s] %s: %s (%s = %.4g %s %.4g, weight %.4g)\n",
+			hit.Rule.Severity, hit.Rule.ID, hit.Rule.Description,
+			hit.Rule.Metric, hit.Value, hit.Rule.Operator, hit.Rule.Threshold, hit.Rule.Weight)
+	}
+	for _, skipped := range assessment.Skipped {
+		fmt.Printf("%s- Skipped rule %s%s\n", Yellow, skipped, Reset)
+	}
+}
+
+// Scores the metrics of every analyzer that ran, the assessment is kept in
+// state for the TUI
+func assessRisk(state *runState) []analysis.Finding {
+	fmt.Printf("\n%s=== Risk Assessment ===%s\n\n", Headers, Reset)
+	assessment := evaluateRisk(riskRules, state.metrics)
+	printRiskAssessment(assessment)
+	state.risk = &assessment
+
+	var findings []analysis.Finding
+	for _, hit := range assessment.Hits {
+		severity, _ := analysis.ParseSeverity(hit.Rule.Severity)
+		findings = append(findings, analysis.Finding{
+			Analyzer: "risk", ID: "risk." + hit.Rule.ID, Severity: severity,
+			Message: fmt.Sprintf("%s (%s = %.4g)", hit.Rule.Description, hit.Rule.Metric, hit.Value),
+		})
+	}
+	return findings
+}
+
+type RiskMetric struct {
+	Analyzer    string
+	Description string
+}
+
+// Metrics listed by "rules metrics", with the analyzer reporting them.
+// A rule on a metric whose analyzer didn't run is skipped
+var riskMetrics = map[string]RiskMetric{
+	"blocklist_matches": {"screening", "Blocklist matches among counterparties"},
+
+	"pending_txs":   {"mempool", "Unconfirmed transactions"},
+	"replaced_txs":  {"mempool", "Pending transactions replaced since the last run"},
+	"double_spends": {"mempool", "Incoming payments double spent since the last run"},
+	"dropped_txs":   {"mempool", "Pending transactions dropped since the last run"},
+
+	"flagged_counterparties": {"patterns", "Counterparties with unusual amount, volume or timing patterns"},
+	"tx_bursts":              {"patterns", "Bursts of transactions within a short window"},
+	"high_value_txs":         {"patterns", "Transactions above the high value threshold"},
+	"frequent_interactors":   {"patterns", "Counterparties with more than 4 transactions"},
+
+	"amount_anomalies":     {"anomaly", "Amounts far above the rolling median"},
+	"timing_anomalies":     {"anomaly", "Unlikely gaps between transactions"},
+	"off_hours_txs":        {"anomaly", "Transactions outside the usual hours of the week"},
+	"volume_change_points": {"anomaly", "Shifts in mean daily volume"},
+
+	"tx_count":                      {"behavior", "Transactions in the fetched history"},
+	"total_volume_btc":              {"behavior", "Total volume in BTC"},
+	"max_tx_btc":                    {"behavior", "Largest single transaction in BTC"},
+	"avg_tx_btc":                    {"behavior", "Average transaction size in BTC"},
+	"max_daily_volume_btc":          {"behavior", "Highest volume on a single day in BTC"},
+	"active_days":                   {"behavior", "Days with at least one transaction"},
+	"active_months":                 {"behavior", "Months with at least one transaction"},
+	"tx_per_day":                    {"behavior", "Transactions per active day"},
+	"counterparty_clusters":         {"behavior", "Distinct counterparty entities (address clusters)"},
+	"linked_clusters":               {"behavior", "Counterparty clusters with more than one address"},
+	"frequent_partners":             {"behavior", "Counterparties with 5 or more transactions"},
+	"high_value_partners":           {"behavior", "Counterparties with more than 5 BTC of volume"},
+	"high_frequency_counterparties": {"behavior", "Counterparties at 5 or more transactions per hour"},
+	"coinjoin_count":                {"behavior", "CoinJoin transactions"},
+	"mixing_volume_pct":             {"behavior", "Share of volume that went through CoinJoins, in percent"},
+
+	"dust_attacks":       {"dust", "Unsolicited dust outputs received"},
+	"dust_spent_linked":  {"dust", "Dust outputs spent together with other coins"},
+	"poisoning_attempts": {"dust", "Dust from addresses imitating a counterparty"},
+
+	"privacy_score": {"privacy", "Privacy score, 0-100"},
+
+	"fee_outliers":    {"fees", "Transactions paying far more or less than the block median"},
+	"median_feerate":  {"fees", "Median feerate of transactions the wallet paid for, in sat/vB"},
+	"total_fees_btc":  {"fees", "Fees paid by the wallet in BTC"},
+	"fee_overpay_btc": {"fees", "Fees paid above the block median in BTC"},
+
+	"utxo_count":          {"utxo", "Unspent outputs"},
+	"dust_utxos":          {"utxo", "Unspent outputs costing more to spend than they are worth at -feerate"},
+	"avg_coin_age_days":   {"utxo", "Value weighted average age of the unspent outputs in days"},
+	"coin_days_destroyed": {"utxo", "Coin-days destroyed by the wallet's spends"},
+
+	"peel_chains":        {"peel", "Peel chains starting at the wallet's transactions"},
+	"longest_peel_chain": {"peel", "Hops in the longest traced peel chain"},
+}
+
+// Flow metrics are per category, for the built-in ones and any other a
+// label uses
+func flowMetric(category, direction string) string {
+	return "flows_" + strings.ReplaceAll(category, "-", "_") + "_" + direction + "_btc"
+}
+
+func init() {
+	for _, category := range append(labelCategories, "unknown") {
+		riskMetrics[flowMetric(category, "in")] = RiskMetric{"flows", "Received from " + category + " counterparties in BTC"}
+		riskMetrics[flowMetric(category, "out")] = RiskMetric{"flows", "Sent to " + category + " counterparties in BTC"}
+	}
+}
+
+func runRules(args []string) {
+	if len(args) > 0 && args[0] == "metrics" {
+		var names []string
+		for name := range riskMetrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("- %s: %s (%s)\n", name, riskMetrics[name].Description, riskMetrics[name].Analyzer)
+		}
+		fmt.Printf("\nFlow metrics exist for your own label categories too, e.g. %s\n", flowMetric("my-category", "out"))
+		return
+	}
+	fmt.Print(defaultRiskRules)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"crypto_tracker/analysis"
+)
+
+func TestParseRiskRules(t *testing.T) {
+	rules, err := parseRiskRules([]byte(`rules:
+  - metric: coinjoin_count
+    operator: ">"
+    threshold: 0
+    weight: 10
+  - id: sanctioned
+    metric: blocklist_matches
+    operator: ">="
+    threshold: 1
+    weight: 5
+    severity: Critical
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("%d rules, want 2", len(rules))
+	}
+	if rules[0].ID != "rule-1" || rules[0].Severity != "medium" {
+		t.Errorf("defaults: id %q severity %q, want rule-1 and medium", rules[0].ID, rules[0].Severity)
+	}
+	if rules[1].Severity != "critical" {
+		t.Errorf("severity %q, want it normalised to critical", rules[1].Severity)
+	}
+
+	if _, err := parseRiskRules([]byte(defaultRiskRules)); err != nil {
+		t.Errorf("built-in rules: %v", err)
+	}
+}
+
+func TestParseRiskRulesInvalid(t *testing.T) {
+	tests := []struct {
+		rules string
+		err   string
+	}{
+		{"rules: [", "failed to parse"},
+		{"rules:\n  - operator: \">\"\n", "no metric"},
+		{"rules:\n  - metric: tx_count\n    operator: \"=>\"\n", "unknown operator"},
+		{"rules:\n  - metric: tx_count\n    operator: \">\"\n    severity: severe\n", "unknown severity"},
+		{"rules:\n  - metric: tx_count\n    operator: \">\"\n    weight: -1\n", "negative weight"},
+	}
+	for _, tt := range tests {
+		_, err := parseRiskRules([]byte(tt.rules))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want one mentioning %q", tt.rules, err, tt.err)
+		}
+	}
+}
+
+func TestEvaluateRisk(t *testing.T) {
+	rules := []RiskRule{
+		{ID: "mixing", Metric: "coinjoin_count", Operator: ">", Threshold: 0, Weight: 30, Severity: "medium"},
+		{ID: "volume", Metric: "max_daily_volume_btc", Operator: ">", Threshold: 5, Weight: 10, Severity: "medium"},
+		{ID: "busy", Metric: "tx_per_day", Operator: ">=", Threshold: 10, Weight: 60, Severity: "high"},
+		{ID: "missing", Metric: "no_such_metric", Operator: ">", Threshold: 0, Weight: 100, Severity: "medium"},
+	}
+	tests := []struct {
+		name    string
+		metrics map[string]float64
+		score   int
+		level   string
+		hits    []string
+	}{
+		{"nothing fires", map[string]float64{"coinjoin_count": 0, "max_daily_volume_btc": 1, "tx_per_day": 2}, 0, "LOW", nil},
+		{"one rule", map[string]float64{"coinjoin_count": 2, "max_daily_volume_btc": 1, "tx_per_day": 2}, 30, "MEDIUM", []string{"mixing"}},
+		{"heaviest first", map[string]float64{"coinjoin_count": 2, "max_daily_volume_btc": 1, "tx_per_day": 10}, 90, "HIGH", []string{"busy", "mixing"}},
+		{"unknown metrics leave the score", map[string]float64{"coinjoin_count": 1}, 100, "HIGH", []string{"mixing"}},
+	}
+	for _, tt := range tests {
+		a := evaluateRisk(rules, tt.metrics)
+		if a.Score != tt.score || a.Level != tt.level {
+			t.Errorf("%s: %s %d, want %s %d", tt.name, a.Level, a.Score, tt.level, tt.score)
+		}
+		var hits []string
+		for _, hit := range a.Hits {
+			hits = append(hits, hit.Rule.ID)
+		}
+		if strings.Join(hits, ",") != strings.Join(tt.hits, ",") {
+			t.Errorf("%s: hits %v, want %v", tt.name, hits, tt.hits)
+		}
+		if len(a.Skipped)+a.Evaluated != len(rules) {
+			t.Errorf("%s: %d evaluated and %d skipped of %d rules", tt.name, a.Evaluated, len(a.Skipped), len(rules))
+		}
+	}
+}
+
+func TestEvaluateRiskCritical(t *testing.T) {
+	rules, err := parseRiskRules([]byte(`rules:
+  - id: sanctioned
+    metric: blocklist_matches
+    operator: ">"
+    threshold: 0
+    weight: 1
+    severity: CRITICAL
+  - id: busy
+    metric: tx_per_day
+    operator: ">"
+    threshold: 10
+    weight: 99
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := evaluateRisk(rules, map[string]float64{"blocklist_matches": 1, "tx_per_day": 1})
+	if a.Level != "CRITICAL" || a.Score != 100 {
+		t.Errorf("%s %d, want a critical rule to pin CRITICAL 100", a.Level, a.Score)
+	}
+}
+
+// Every metric an analyzer reports is documented in "rules metrics", and
+// every documented one is reported when all analyzers run
+func TestRiskMetricsListed(t *testing.T) {
+	var transactions []Transaction
+	for i := 0; i < 8; i++ {
+		txid := string(rune('a' + i))
+		transactions = append(transactions,
+			testTx(txid, 1_700_000_000+i*86_400, []testIO{{testLegacy, 10_001_000}}, []testIO{{testWatched, 10_000_000}}))
+	}
+	transactions = append(transactions,
+		testTx("out", 1_701_000_000, []testIO{{testWatched, 10_000_000}}, []testIO{{testSegwit, 1_000_000}, {testWatched, 8_999_000}}))
+
+	state := &runState{db: testDB(t), clusters: buildClusters(transactions), feeRate: 10, peelDepth: 10, readOnly: true}
+	ctx := &analysis.Context{Address: testWatched, Transactions: transactions, Fetcher: &testFetcher{}, State: state}
+	analyzers, err := parseAnalyzers("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := silenceOutput()
+	runAnalyzers(analyzers, ctx)
+	restore()
+
+	for name := range state.metrics {
+		if _, ok := riskMetrics[name]; !ok {
+			t.Errorf("metric %s is reported but not listed", name)
+		}
+	}
+	for name, metric := range riskMetrics {
+		if _, ok := state.metrics[name]; !ok {
+			t.Errorf("metric %s of %s is listed but not reported", name, metric.Analyzer)
+		}
+	}
+	if state.risk == nil {
+		t.Errorf("no risk assessment after the analyzers ran")
+	}
+}
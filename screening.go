@@ -0,0 +1,421 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+type BlocklistEntry struct {
+	List     string
+	Address  string
+	Entity   string
+	Metadata map[string]string
+}
+
+type ScreeningMatch struct {
+	Entry BlocklistEntry
+	TxID  string
+	Hop   int    // 0 = the tx itself, 1 = a tx next to it
+	Role  string // input or output
+}
+
+func (m ScreeningMatch) String() string {
+	where := "of"
+	if m.Hop > 0 {
+		where = fmt.Sprintf("%d hop from", m.Hop)
+	}
+	text := fmt.Sprintf("%s on %s", labelAddress(m.Entry.Address), m.Entry.List)
+	if m.Entry.Entity != "" {
+		text += fmt.Sprintf(" (%s)", m.Entry.Entity)
+	}
+	text += fmt.Sprintf(" as %s %s tx %s", m.Role, where, m.TxID)
+
+	var keys []string
+	for key := range m.Entry.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		text += fmt.Sprintf(", %s: %s", key, m.Entry.Metadata[key])
+	}
+	return text
+}
+
+// Blocklist matches as critical findings. They are added whatever
+// -analyzers selects, so a match always shows up and reaches the registry
+func screeningFindings(matches []ScreeningMatch) []analysis.Finding {
+	var findings []analysis.Finding
+	for _, m := range matches {
+		findings = append(findings, analysis.Finding{
+			Analyzer: "screening", ID: "screening.blocklist", Severity: analysis.Critical,
+			Message: "On blocklist " + m.Entry.List, TxIDs: []string{m.TxID}, Addresses: []string{m.Entry.Address},
+		})
+	}
+	return findings
+}
+
+func initBlocklistTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS blocklist (
+            list     TEXT NOT NULL,
+            address  TEXT NOT NULL,
+            entity   TEXT NOT NULL DEFAULT '',
+            metadata TEXT NOT NULL DEFAULT '{}',
+            added_at INTEGER NOT NULL,
+            PRIMARY KEY (list, address)
+        );
+        CREATE INDEX IF NOT EXISTS blocklist_address ON blocklist (address);`)
+	return err
+}
+
+// OFAC publishes addresses in the SDN remarks as "Digital Currency Address - XBT <addr>"
+var ofacXBTPattern = regexp.MustCompile(`Digital Currency Address - XBT\s+([A-Za-z0-9]+)`)
+
+// Plain extracts (one address per line) and raw SDN text are both accepted
+func parseOFAC(r io.Reader) ([]BlocklistEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []BlocklistEntry
+	matches := ofacXBTPattern.FindAllStringSubmatch(string(data), -1)
+	if len(matches) > 0 {
+		for _, match := range matches {
+			entries = append(entries, BlocklistEntry{Address: match[1], Entity: "OFAC SDN"})
+		}
+		return entries, nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, BlocklistEntry{Address: line, Entity: "OFAC SDN"})
+	}
+	return entries, nil
+}
+
+// CSV with a header row. The address column is required, name/entity
+// becomes the entity and every other column is kept as metadata
+func parseBlocklistCSV(r io.Reader) ([]BlocklistEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	header := rows[0]
+	addrCol := -1
+	for i, name := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+		if header[i] == "address" {
+			addrCol = i
+		}
+	}
+	if addrCol < 0 {
+		return nil, fmt.Errorf("CSV has no address column")
+	}
+
+	var entries []BlocklistEntry
+	for _, row := range rows[1:] {
+		entry := BlocklistEntry{Metadata: make(map[string]string)}
+		for i, value := range row {
+			if i >= len(header) || value == "" {
+				continue
+			}
+			switch header[i] {
+			case "address":
+				entry.Address = strings.TrimSpace(value)
+			case "name", "entity":
+				entry.Entity = value
+			default:
+				entry.Metadata[header[i]] = value
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// JSON array of objects, same field rules as the CSV format
+func parseBlocklistJSON(r io.Reader) ([]BlocklistEntry, error) {
+	var items []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+
+	var entries []BlocklistEntry
+	for _, item := range items {
+		entry := BlocklistEntry{Metadata: make(map[string]string)}
+		for key, value := range item {
+			text := fmt.Sprint(value)
+			switch strings.ToLower(key) {
+			case "address":
+				entry.Address = strings.TrimSpace(text)
+			case "name", "entity":
+				entry.Entity = text
+			default:
+				entry.Metadata[key] = text
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Replaces the named list with the entries from the file
+func importBlocklist(db *sql.DB, list, format, path string) (int, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var entries []BlocklistEntry
+	switch format {
+	case "ofac":
+		entries, err = parseOFAC(file)
+	case "csv":
+		entries, err = parseBlocklistCSV(file)
+	case "json":
+		entries, err = parseBlocklistJSON(file)
+	default:
+		return 0, 0, fmt.Errorf("unknown blocklist format %q (expected ofac, csv or json)", format)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := initBlocklistTable(db); err != nil {
+		return 0, 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM blocklist WHERE list = ?`, list); err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+
+	var imported, skipped int
+	now := time.Now().Unix()
+	for _, entry := range entries {
+		if _, err := decodeAddress(entry.Address); err != nil {
+			skipped++
+			continue
+		}
+		metadata, _ := json.Marshal(entry.Metadata)
+		_, err := tx.Exec(`INSERT OR REPLACE INTO blocklist (list, address, entity, metadata, added_at) VALUES (?, ?, ?, ?, ?)`,
+			list, entry.Address, entry.Entity, string(metadata), now)
+		if err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
+		imported++
+	}
+	return imported, skipped, tx.Commit()
+}
+
+// Blocklist entries for any of the given addresses
+func lookupBlocklist(db *sql.DB, addresses []string) (map[string][]BlocklistEntry, error) {
+	found := make(map[string][]BlocklistEntry)
+	if err := initBlocklistTable(db); err != nil {
+		return nil, err
+	}
+
+	stmt, err := db.Prepare(`SELECT list, entity, metadata FROM blocklist WHERE address = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, addr := range addresses {
+		rows, err := stmt.Query(addr)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			entry := BlocklistEntry{Address: addr}
+			var metadata string
+			if err := rows.Scan(&entry.List, &entry.Entity, &metadata); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			json.Unmarshal([]byte(metadata), &entry.Metadata)
+			found[addr] = append(found[addr], entry)
+		}
+		rows.Close()
+	}
+	return found, nil
+}
+
+// Checks every input/output address of the wallet's txs against the
+// blocklists. With hops > 0 the txs funding our counterparties and the
+// txs spending our payments are fetched too, up to limit requests
+func screenTransactions(db *sql.DB, transactions []Transaction, address string, hops int, limit int) ([]ScreeningMatch, error) {
+	type seenAddr struct {
+		txid string
+		hop  int
+		role string
+	}
+	seen := make(map[string]seenAddr)
+	note := func(addr, txid string, hop int, role string) {
+		if addr == "" || addr == address {
+			return
+		}
+		if prev, ok := seen[addr]; ok && prev.hop <= hop {
+			return
+		}
+		seen[addr] = seenAddr{txid, hop, role}
+	}
+
+	requests := 0
+	for _, tx := range transactions {
+		for _, in := range tx.Inputs {
+			note(in.PrevOut.Addr, tx.TxID, 0, "input")
+		}
+		for _, out := range tx.Out {
+			note(out.Addr, tx.TxID, 0, "output")
+		}
+		if hops < 1 {
+			continue
+		}
+
+		// One hop back from whoever paid us, one hop forward from whoever we paid
+		incoming := !paidByWallet(tx, address)
+		if incoming {
+			for _, in := range tx.Inputs {
+				if requests >= limit {
+					break
+				}
+				requests++
+				prev, err := backend.FetchTransaction(in.PrevRef())
+				if err != nil {
+					continue
+				}
+				for _, prevIn := range prev.Inputs {
+					note(prevIn.PrevOut.Addr, prev.TxID, 1, "input")
+				}
+			}
+			continue
+		}
+		for _, out := range tx.Out {
+			if out.Addr == address || requests >= limit {
+				continue
+			}
+			requests++
+			next, err := backend.FetchOutspend(tx.Ref(), out.N)
+			if err != nil || next == nil {
+				continue
+			}
+			for _, nextOut := range next.Out {
+				note(nextOut.Addr, next.TxID, 1, "output")
+			}
+		}
+	}
+
+	var addrs []string
+	for addr := range seen {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	found, err := lookupBlocklist(db, addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ScreeningMatch
+	for _, addr := range addrs {
+		for _, entry := range found[addr] {
+			where := seen[addr]
+			matches = append(matches, ScreeningMatch{Entry: entry, TxID: where.txid, Hop: where.hop, Role: where.role})
+		}
+	}
+	return matches, nil
+}
+
+func runScreen(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Usage: screen import|lists|check ...")
+	}
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if err := initBlocklistTable(db); err != nil {
+		log.Fatalf("Error creating blocklist table: %v", err)
+	}
+
+	switch args[0] {
+	case "import":
+		fs := flag.NewFlagSet("screen import", flag.ExitOnError)
+		list := fs.String("list", "", "Name of the list, e.g. OFAC")
+		format := fs.String("format", "ofac", "File format: ofac, csv or json")
+		path := fs.String("file", "", "File to import")
+		fs.Parse(args[1:])
+		if *list == "" || *path == "" {
+			log.Fatal("Usage: screen import -list <name> -format ofac|csv|json -file <path>")
+		}
+
+		imported, skipped, err := importBlocklist(db, *list, *format, *path)
+		if err != nil {
+			log.Fatalf("Error importing blocklist: %v", err)
+		}
+		fmt.Printf("Imported %d addresses into %s (%d invalid addresses skipped)\n", imported, *list, skipped)
+
+	case "lists":
+		rows, err := db.Query(`SELECT list, COUNT(*), MAX(added_at) FROM blocklist GROUP BY list ORDER BY list`)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var list string
+			var count int
+			var added int64
+			if err := rows.Scan(&list, &count, &added); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("- %s: %d addresses (imported %s)\n", list, count, time.Unix(added, 0).Format("2006-01-02 15:04:05"))
+		}
+
+	case "check":
+		fs := flag.NewFlagSet("screen check", flag.ExitOnError)
+		addr := fs.String("address", "", "Address to look up")
+		fs.Parse(args[1:])
+
+		found, err := lookupBlocklist(db, []string{*addr})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(found[*addr]) == 0 {
+			fmt.Printf("%s%s is not on any blocklist%s\n", Green, *addr, Reset)
+			return
+		}
+		for _, entry := range found[*addr] {
+			fmt.Printf("%s%s is on %s%s %s %v\n", Red, *addr, entry.List, Reset, entry.Entity, entry.Metadata)
+		}
+
+	default:
+		log.Fatalf("Unknown screen command %q", args[0])
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseOFAC(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			"SDN remarks",
+			"LAZARUS GROUP ... Digital Currency Address - XBT 1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2; alt. Digital Currency Address - ETH 0xabc; " +
+				"Digital Currency Address - XBT  bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4;",
+			[]string{testLegacy, testSegwit},
+		},
+		{"plain extract", "# OFAC XBT\n" + testLegacy + "\n\n  " + testSegwit + "  \n", []string{testLegacy, testSegwit}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		entries, err := parseOFAC(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.Address)
+			if entry.Entity != "OFAC SDN" {
+				t.Errorf("%s: entity %q, want OFAC SDN", tt.name, entry.Entity)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: addresses %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlocklistCSV(t *testing.T) {
+	entries, err := parseBlocklistCSV(strings.NewReader(
+		"Name, Address ,Source,Note\n" +
+			"Scam Exchange, " + testLegacy + " ,chainabuse,\n" +
+			"," + testSegwit + ",,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Address != testLegacy || e.Entity != "Scam Exchange" || fmt.Sprint(e.Metadata) != "map[source:chainabuse]" {
+		t.Errorf("first entry %+v, want the entity and only the non-empty metadata", e)
+	}
+	if e := entries[1]; e.Address != testSegwit || e.Entity != "" || len(e.Metadata) != 0 {
+		t.Errorf("second entry %+v, want only the address", e)
+	}
+
+	for _, input := range []string{"name,source\nx,y\n", "address,name\n\"unterminated\n"} {
+		if _, err := parseBlocklistCSV(strings.NewReader(input)); err == nil {
+			t.Errorf("%q: no error", input)
+		}
+	}
+}
+
+func TestParseBlocklistJSON(t *testing.T) {
+	entries, err := parseBlocklistJSON(strings.NewReader(
+		`[{"address": " ` + testLegacy + ` ", "Entity": "Mixer", "score": 9}, {"ADDRESS": "` + testSegwit + `"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Address != testLegacy || e.Entity != "Mixer" || e.Metadata["score"] != "9" {
+		t.Errorf("first entry %+v, want the entity and the score as metadata", e)
+	}
+	if entries[1].Address != testSegwit {
+		t.Errorf("second entry %+v, want field names matched case-insensitively", entries[1])
+	}
+
+	if _, err := parseBlocklistJSON(strings.NewReader(`{"address": "x"}`)); err == nil {
+		t.Errorf("object instead of an array: no error")
+	}
+}
+
+func TestImportBlocklist(t *testing.T) {
+	db := testDB(t)
+	path := filepath.Join(t.TempDir(), "list.txt")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(testLegacy + "\nnot-an-address\n" + testSegwit + "\n")
+	imported, skipped, err := importBlocklist(db, "ofac", "ofac", path)
+	if err != nil || imported != 2 || skipped != 1 {
+		t.Fatalf("imported %d, skipped %d (%v), want 2 and 1", imported, skipped, err)
+	}
+
+	// A re-import replaces the list
+	write(testLegacy + "\n")
+	if _, _, err := importBlocklist(db, "ofac", "ofac", path); err != nil {
+		t.Fatal(err)
+	}
+	found, err := lookupBlocklist(db, []string{testLegacy, testSegwit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found[testLegacy]) != 1 || len(found[testSegwit]) != 0 {
+		t.Errorf("found %v, want only %s after the re-import", found, testLegacy)
+	}
+
+	if _, _, err := importBlocklist(db, "x", "xml", path); err == nil {
+		t.Errorf("unknown format: no error")
+	}
+}
+
+func TestScreenTransactions(t *testing.T) {
+	db := testDB(t)
+	path := filepath.Join(t.TempDir(), "list.csv")
+	os.WriteFile(path, []byte("address,entity\n"+testTaproot+",Darknet market\n"+testScript+",Ransomware\n"), 0o644)
+	if _, _, err := importBlocklist(db, "test", "csv", path); err != nil {
+		t.Fatal(err)
+	}
+
+	// testTaproot funded the sender one hop back, testScript is paid directly
+	funding := testTx("funding", 0, []testIO{{testTaproot, 2_000_000}}, []testIO{{testLegacy, 1_999_000}})
+	in := testTx("in", 0, []testIO{{testLegacy, 1_999_000}}, []testIO{{testWatched, 1_998_000}})
+	testSpend(&in, 0, funding, 0)
+	out := testTx("out", 0, []testIO{{testWatched, 1_998_000}}, []testIO{{testScript, 1_000_000}, {testWatched, 997_000}})
+	test := &testBackend{testFetcher: testFetcher{txs: map[string]Transaction{"funding": funding}}}
+	saved := backend
+	backend = test
+	t.Cleanup(func() { backend = saved })
+
+	tests := []struct {
+		hops, limit int
+		want        string
+	}{
+		{0, 10, "[Ransomware@out:0:output]"},
+		{1, 10, "[Darknet market@funding:1:input Ransomware@out:0:output]"},
+		{1, 0, "[Ransomware@out:0:output]"},
+	}
+	for _, tt := range tests {
+		matches, err := screenTransactions(db, []Transaction{in, out}, testWatched, tt.hops, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, fmt.Sprintf("%s@%s:%d:%s", m.Entry.Entity, m.TxID, m.Hop, m.Role))
+		}
+		sort.Strings(got)
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%d hops, limit %d: matches %v, want %s", tt.hops, tt.limit, got, tt.want)
+		}
+	}
+}
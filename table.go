@@ -0,0 +1,241 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignRight
+)
+
+type Column struct {
+	Title    string
+	Align    Align
+	Min      int // narrowest the column is shrunk to, 0 = never shrunk
+	Priority int // when shrinking isn't enough, the lowest priority column goes first
+	// Shortens a cell to width display cells, cuts the end when nil
+	Abbrev func(text string, width int) string
+}
+
+type Cell struct {
+	Text  string
+	Color string
+}
+
+// Box-drawn table fitted to a width: columns are shrunk to their Min,
+// then dropped by priority until the table fits
+type Table struct {
+	Columns []Column
+	rows    [][]Cell
+}
+
+func (t *Table) AddRow(cells ...Cell) {
+	t.rows = append(t.rows, cells)
+}
+
+// Display width, wide CJK and emoji count as two cells
+func displayWidth(s string) int {
+	return runewidth.StringWidth(s)
+}
+
+func truncateEnd(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.Truncate(s, width, "…")
+}
+
+// Keeps both ends, txids and addresses are recognised by them
+func truncateMiddle(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	if width <= 2 {
+		return truncateEnd(s, width)
+	}
+	tail := (width - 1) / 2
+	head := runewidth.Truncate(s, width-1-tail, "")
+	// Whole runes from the end, TruncateLeft would put a space in for a
+	// wide rune it cuts
+	runes := []rune(s)
+	start, used := len(runes), 0
+	for start > 0 && used+runewidth.RuneWidth(runes[start-1]) <= tail {
+		start--
+		used += runewidth.RuneWidth(runes[start])
+	}
+	// A wide rune cut at either end leaves a cell free, pad it
+	return runewidth.FillRight(head+"…"+string(runes[start:]), width)
+}
+
+// Shortens the address and keeps its " [label]" suffix as long as there is room
+func abbreviateAddress(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	addr, label, found := strings.Cut(s, " [")
+	if found && width-displayWidth(label)-2 >= 12 {
+		return truncateMiddle(addr, width-displayWidth(label)-2) + " [" + label
+	}
+	if found {
+		return truncateEnd(truncateMiddle(addr, 12)+" ["+label, width)
+	}
+	return truncateMiddle(addr, width)
+}
+
+// Pads or cuts s to exactly width display cells
+func fitWidth(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	return runewidth.FillRight(truncateEnd(s, width), width)
+}
+
+// Widths and indexes of the columns that fit in width, 0 means no limit
+func (t *Table) layout(width int) ([]int, []int) {
+	natural := make([]int, len(t.Columns))
+	for i, col := range t.Columns {
+		natural[i] = displayWidth(col.Title)
+		for _, row := range t.rows {
+			if i < len(row) {
+				natural[i] = max(natural[i], displayWidth(row[i].Text))
+			}
+		}
+	}
+
+	visible := make([]int, len(t.Columns))
+	for i := range visible {
+		visible[i] = i
+	}
+	for {
+		widths := make([]int, len(visible))
+		total := 3*len(visible) + 1 // "║ ", " │ " between columns, " ║"
+		for j, i := range visible {
+			widths[j] = natural[i]
+			total += widths[j]
+		}
+		if width <= 0 || total <= width {
+			return visible, widths
+		}
+
+		// Take one cell at a time from the column with the most room to give
+		for total > width {
+			best := -1
+			for j, i := range visible {
+				min := t.Columns[i].Min
+				if min == 0 || widths[j] <= min {
+					continue
+				}
+				if best < 0 || widths[j]-min > widths[best]-t.Columns[visible[best]].Min {
+					best = j
+				}
+			}
+			if best < 0 {
+				break
+			}
+			widths[best]--
+			total--
+		}
+		if total <= width || len(visible) == 1 {
+			return visible, widths
+		}
+
+		// Still too wide, drop the least important column (rightmost on ties)
+		drop := 0
+		for j, i := range visible {
+			if t.Columns[i].Priority <= t.Columns[visible[drop]].Priority {
+				drop = j
+			}
+		}
+		visible = append(visible[:drop:drop], visible[drop+1:]...)
+	}
+}
+
+func (t *Table) Render(w io.Writer, width int) {
+	visible, widths := t.layout(width)
+
+	var b strings.Builder
+	border := func(left, fill, sep, right string) {
+		b.WriteString(Headers + left)
+		for j, w := range widths {
+			if j > 0 {
+				b.WriteString(sep)
+			}
+			b.WriteString(strings.Repeat(fill, w+2))
+		}
+		b.WriteString(right + Reset + "\n")
+	}
+	row := func(cells []Cell, header bool) {
+		b.WriteString(Headers + "║" + Reset)
+		for j, i := range visible {
+			if j > 0 {
+				b.WriteString(Headers + "│" + Reset)
+			}
+			col := t.Columns[i]
+			var cell Cell
+			if header {
+				cell = Cell{Text: col.Title, Color: Headers}
+			} else if i < len(cells) {
+				cell = cells[i]
+			}
+
+			text := cell.Text
+			if displayWidth(text) > widths[j] {
+				if col.Abbrev != nil && !header {
+					text = col.Abbrev(text, widths[j])
+				}
+				text = truncateEnd(text, widths[j])
+			}
+			if col.Align == AlignRight {
+				text = runewidth.FillLeft(text, widths[j])
+			} else {
+				text = runewidth.FillRight(text, widths[j])
+			}
+			if cell.Color != "" {
+				text = cell.Color + text + Reset
+			}
+			b.WriteString(" " + text + " ")
+		}
+		b.WriteString(Headers + "║" + Reset + "\n")
+	}
+
+	border("╔", "═", "╤", "╗")
+	row(nil, true)
+	border("╠", "═", "╪", "╣")
+	for _, cells := range t.rows {
+		row(cells, false)
+	}
+	border("╚", "═", "╧", "╝")
+	io.WriteString(w, b.String())
+}
+
+// Single column box with a title in the top border, for key/value summaries
+func renderBox(w io.Writer, title string, lines []string, width int) {
+	inner := displayWidth(title) + 4
+	for _, line := range lines {
+		inner = max(inner, displayWidth(line))
+	}
+	// Never narrower than the title, a tiny $COLUMNS just overflows
+	if width > 0 {
+		inner = max(min(inner, width-4), displayWidth(title)+2)
+	}
+
+	var b strings.Builder
+	label := " " + truncateEnd(title, inner-2) + " "
+	left := (inner + 2 - displayWidth(label)) / 2
+	right := inner + 2 - displayWidth(label) - left
+	b.WriteString(Headers + "╔" + strings.Repeat("═", left) + label + strings.Repeat("═", right) + "╗" + Reset + "\n")
+	for _, line := range lines {
+		b.WriteString(Headers + "║ " + fitWidth(line, inner) + " ║" + Reset + "\n")
+	}
+	b.WriteString(Headers + "╚" + strings.Repeat("═", inner+2) + "╝" + Reset + "\n")
+	io.WriteString(w, b.String())
+}
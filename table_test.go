@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ansiCodes = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		out   string
+	}{
+		{"abcdef", 10, "abcdef"},
+		{"abcdefghij", 7, "abc…hij"},
+		{"abcdefghij", 6, "abc…ij"},
+		{"abcdefghij", 2, "a…"},
+		{"交易所热钱包", 7, "交…包  "},
+		{"交易所热钱包", 8, "交易…包 "},
+		{"ab交易所cd", 6, "ab…cd "},
+	}
+	for _, tt := range tests {
+		got := truncateMiddle(tt.in, tt.width)
+		if got != tt.out {
+			t.Errorf("truncateMiddle(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.out)
+		}
+		if tt.width < displayWidth(tt.in) && displayWidth(got) != tt.width {
+			t.Errorf("truncateMiddle(%q, %d) is %d cells wide", tt.in, tt.width, displayWidth(got))
+		}
+	}
+}
+
+func TestAbbreviateAddress(t *testing.T) {
+	addr := "bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080"
+	tests := []struct {
+		in    string
+		width int
+		out   string
+	}{
+		{addr, 60, addr},
+		{addr, 15, "bcrt1qw…kygt080"},
+		{addr + " [交易所]", 30, truncateMiddle(addr, 21) + " [交易所]"},
+		{addr + " [交易所]", 16, truncateEnd(truncateMiddle(addr, 12)+" [交易所]", 16)},
+	}
+	for _, tt := range tests {
+		got := abbreviateAddress(tt.in, tt.width)
+		if got != tt.out {
+			t.Errorf("abbreviateAddress(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.out)
+		}
+		if displayWidth(got) > tt.width {
+			t.Errorf("abbreviateAddress(%q, %d) is %d cells wide", tt.in, tt.width, displayWidth(got))
+		}
+	}
+}
+
+func testTable() *Table {
+	table := &Table{Columns: []Column{
+		{Title: "ID", Min: 6, Priority: 9, Abbrev: truncateMiddle},
+		{Title: "Amount", Align: AlignRight, Priority: 10},
+		{Title: "Label", Min: 4, Priority: 5},
+		{Title: "Fee", Priority: 1},
+	}}
+	table.AddRow(Cell{Text: "0123456789abcdef"}, Cell{Text: "1.50000000", Color: Green}, Cell{Text: "交易所热钱包"}, Cell{Text: "500"})
+	table.AddRow(Cell{Text: "fedcba9876543210"}, Cell{Text: "-0.25000000", Color: Red}, Cell{Text: "🚀 shop"}, Cell{Text: "1200"})
+	return table
+}
+
+func TestTableLayout(t *testing.T) {
+	tests := []struct {
+		width   int
+		visible []int
+		widths  []int
+	}{
+		// Natural widths 16, 11, 12, 4 plus 13 for the borders = 56
+		{0, []int{0, 1, 2, 3}, []int{16, 11, 12, 4}},
+		{56, []int{0, 1, 2, 3}, []int{16, 11, 12, 4}},
+		// The column with the most room to give shrinks first
+		{50, []int{0, 1, 2, 3}, []int{12, 11, 10, 4}},
+		{38, []int{0, 1, 2, 3}, []int{6, 11, 4, 4}},
+		// Shrinking isn't enough, Fee has the lowest priority
+		{37, []int{0, 1, 2}, []int{9, 11, 7}},
+		{31, []int{0, 1, 2}, []int{6, 11, 4}},
+		{30, []int{0, 1}, []int{12, 11}},
+		{10, []int{1}, []int{11}},
+	}
+	for _, tt := range tests {
+		visible, widths := testTable().layout(tt.width)
+		if fmt.Sprint(visible) != fmt.Sprint(tt.visible) || fmt.Sprint(widths) != fmt.Sprint(tt.widths) {
+			t.Errorf("width %d: columns %v widths %v, want %v %v", tt.width, visible, widths, tt.visible, tt.widths)
+		}
+	}
+}
+
+func TestTableRenderAligned(t *testing.T) {
+	for _, width := range []int{0, 80, 50, 38, 31, 20} {
+		var b strings.Builder
+		testTable().Render(&b, width)
+		lines := strings.Split(strings.TrimSuffix(ansiCodes.ReplaceAllString(b.String(), ""), "\n"), "\n")
+		if len(lines) != 6 {
+			t.Fatalf("width %d: %d lines, want 6", width, len(lines))
+		}
+		for _, line := range lines {
+			if displayWidth(line) != displayWidth(lines[0]) {
+				t.Errorf("width %d: %q is %d cells, the top border %d", width, line, displayWidth(line), displayWidth(lines[0]))
+			}
+		}
+		if width > 0 && displayWidth(lines[0]) > width && width >= 31 {
+			t.Errorf("width %d: table is %d cells wide", width, displayWidth(lines[0]))
+		}
+	}
+}
+
+func TestRenderBoxTinyWidth(t *testing.T) {
+	for _, width := range []int{0, 1, 3, 10, 40} {
+		var b strings.Builder
+		renderBox(&b, "Wallet Summary", []string{"Address: bcrt1qw508d6qejxtdg4y5r3zarvary0c5xw7kygt080", "Label: 交易所"}, width)
+		lines := strings.Split(strings.TrimSuffix(ansiCodes.ReplaceAllString(b.String(), ""), "\n"), "\n")
+		for _, line := range lines {
+			if displayWidth(line) != displayWidth(lines[0]) {
+				t.Errorf("width %d: %q is %d cells, the top border %d", width, line, displayWidth(line), displayWidth(lines[0]))
+			}
+		}
+		if !strings.Contains(lines[0], "Wallet Summary") {
+			t.Errorf("width %d: title cut in %q", width, lines[0])
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"crypto_tracker/analysis"
+)
+
+// Address -> label of the configured risk list. Lines are
+// "address[,label]", blank lines and # comments are skipped
+func loadRiskList(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open risk list: %v", err)
+	}
+	defer file.Close()
+
+	list := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 2)
+		label := "risk list"
+		if len(fields) == 2 {
+			label = strings.TrimSpace(fields[1])
+		}
+		list[strings.TrimSpace(fields[0])] = label
+	}
+	return list, scanner.Err()
+}
+
+func initTxCache(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS tx_cache (
+            ref  TEXT PRIMARY KEY,
+            data TEXT NOT NULL
+        )`)
+	return err
+}
+
+// Taint of a tx's outputs under both models
+type taintResult struct {
+	haircut float64 // share of the value from risky sources
+	poison  bool    // any risky source at all
+}
+
+type taintHit struct {
+	Address string
+	Label   string
+	TxID    string
+	Hop     int
+}
+
+// Walks inputs backwards, fetching previous txs through fetcher with an
+// in-memory and sqlite cache and a hard request budget. Coins moving
+// within the wallet don't count as a hop
+type taintTracer struct {
+	db        *sql.DB
+	fetcher   analysis.Fetcher
+	address   string
+	riskList  map[string]string
+	maxHops   int
+	budget    int
+	requests  int
+	exhausted bool
+	cache     map[string]*Transaction
+	memo      map[string]taintResult
+	hits      map[string]taintHit
+}
+
+func newTaintTracer(db *sql.DB, fetcher analysis.Fetcher, address string, riskList map[string]string, maxHops, budget int) *taintTracer {
+	if db != nil {
+		if err := initTxCache(db); err != nil {
+			log.Printf("Error creating tx cache, continuing without it: %v", err)
+			db = nil
+		}
+	}
+	return &taintTracer{
+		db:       db,
+		fetcher:  fetcher,
+		address:  address,
+		riskList: riskList,
+		maxHops:  maxHops,
+		budget:   budget,
+		cache:    make(map[string]*Transaction),
+		memo:     make(map[string]taintResult),
+		hits:     make(map[string]taintHit),
+	}
+}
+
+func (t *taintTracer) fetch(ref string) (*Transaction, error) {
+	if tx, ok := t.cache[ref]; ok {
+		return tx, nil
+	}
+
+	if t.db != nil {
+		var data string
+		if err := t.db.QueryRow(`SELECT data FROM tx_cache WHERE ref = ?`, ref).Scan(&data); err == nil {
+			var tx Transaction
+			if err := json.Unmarshal([]byte(data), &tx); err == nil {
+				t.cache[ref] = &tx
+				return &tx, nil
+			}
+		}
+	}
+
+	if t.requests >= t.budget {
+		t.exhausted = true
+		return nil, fmt.Errorf("request budget of %d exhausted", t.budget)
+	}
+	t.requests++
+	tx, err := t.fetcher.FetchTransaction(ref)
+	if err != nil {
+		return nil, err
+	}
+	t.cache[ref] = tx
+
+	// Only confirmed txs are immutable enough to keep
+	if t.db != nil && !tx.Pending() {
+		if data, err := json.Marshal(tx); err == nil {
+			t.db.Exec(`INSERT OR REPLACE INTO tx_cache (ref, data) VALUES (?, ?)`, ref, string(data))
+		}
+	}
+	return tx, nil
+}
+
+// Taint of the outputs of tx, hop being how many txs from outside the
+// wallet it is away from it
+func (t *taintTracer) txTaint(tx Transaction, hop int) taintResult {
+	key := fmt.Sprintf("%s@%d", tx.TxID, hop)
+	if result, ok := t.memo[key]; ok {
+		return result
+	}
+
+	var result taintResult
+	var total, tainted float64
+	for _, in := range tx.Inputs {
+		value := float64(in.PrevOut.Value)
+		total += value
+
+		var inputTaint taintResult
+		if label, ok := t.riskList[in.PrevOut.Addr]; ok {
+			inputTaint = taintResult{haircut: 1, poison: true}
+			hitKey := in.PrevOut.Addr + tx.TxID
+			if _, seen := t.hits[hitKey]; !seen {
+				t.hits[hitKey] = taintHit{Address: in.PrevOut.Addr, Label: label, TxID: tx.TxID, Hop: hop}
+			}
+		} else if in.PrevOut.Addr == t.address {
+			// Own change or consolidation, the coins came from further back
+			if prev, err := t.fetch(in.PrevRef()); err == nil {
+				inputTaint = t.txTaint(*prev, hop)
+			}
+		} else if hop < t.maxHops && in.PrevOut.Addr != "" {
+			prev, err := t.fetch(in.PrevRef())
+			if err == nil {
+				inputTaint = t.txTaint(*prev, hop+1)
+			}
+		}
+
+		tainted += value * inputTaint.haircut
+		result.poison = result.poison || inputTaint.poison
+	}
+	if total > 0 {
+		result.haircut = tainted / total
+	}
+
+	t.memo[key] = result
+	return result
+}
+
+func runTrace(args []string) {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	address := fs.String("wallet", "", "Bitcoin wallet address to trace")
+	hops := fs.Int("hops", 3, "How many transactions to walk back from each incoming payment")
+	riskPath := fs.String("risk-list", "", "File with risky addresses, one \"address[,label]\" per line")
+	budget := fs.Int("budget", 200, "Max backend requests for the whole trace")
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	if *address == "" || *riskPath == "" {
+		log.Fatal("Usage: trace -wallet <address> -risk-list <file> [-hops N] [-budget N]")
+	}
+	common.apply()
+	if _, err := validateAddress(*address, network); err != nil {
+		log.Fatalf("Invalid wallet address: %v", err)
+	}
+
+	riskList, err := loadRiskList(*riskPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if store, err := loadLabels(db); err == nil {
+		labels = store
+	}
+
+	wallet, err := backend.FetchWallet(*address)
+	if err != nil {
+		log.Fatalf("Error fetching wallet: %v", err)
+	}
+
+	tracer := newTaintTracer(db, backend, *address, riskList, *hops, *budget)
+	for i := range wallet.Transactions {
+		tx := &wallet.Transactions[i]
+		tracer.cache[tx.Ref()] = tx
+		tracer.cache[tx.TxID] = tx
+	}
+
+	fmt.Printf("\n%s=== Source of Funds Trace ===%s\n\n", Yellow, Reset)
+	fmt.Printf("- Address: %s\n", *address)
+	fmt.Printf("- Risk List: %s (%d addresses)\n", *riskPath, len(riskList))
+	fmt.Printf("- Hops: %d, Request Budget: %d\n", *hops, *budget)
+
+	fmt.Printf("\n%sIncoming Payments:%s\n", Cyan, Reset)
+	for _, tx := range wallet.Transactions {
+		amount := netAmount(*address, tx)
+		if amount <= 0 {
+			continue
+		}
+		taint := tracer.txTaint(tx, 0)
+		color := Green
+		if taint.poison {
+			color = Red
+		}
+		fmt.Printf("- %s%s%s %.8f BTC: haircut %.2f%%, poison %v\n",
+			color, tx.TxID, Reset, float64(amount)/100_000_000, taint.haircut*100, taint.poison)
+	}
+
+	// Balance attribution goes through the utxos the wallet still holds
+	byID := make(map[string]Transaction)
+	for _, tx := range wallet.Transactions {
+		byID[tx.TxID] = tx
+	}
+	var balance, haircutValue, poisonValue float64
+	for _, utxo := range buildUTXOSet(wallet.Transactions, *address) {
+		taint := tracer.txTaint(byID[utxo.TxID], 0)
+		value := float64(utxo.Value)
+		balance += value
+		haircutValue += value * taint.haircut
+		if taint.poison {
+			poisonValue += value
+		}
+	}
+
+	fmt.Printf("\n%sCurrent Balance:%s\n", Cyan, Reset)
+	if balance == 0 {
+		fmt.Printf("- No unspent balance in the fetched history\n")
+	} else {
+		fmt.Printf("- Haircut Model: %.8f of %.8f BTC (%.2f%%) from listed sources\n",
+			haircutValue/100_000_000, balance/100_000_000, 100*haircutValue/balance)
+		fmt.Printf("- Poison Model: %.8f of %.8f BTC (%.2f%%) touched by listed sources\n",
+			poisonValue/100_000_000, balance/100_000_000, 100*poisonValue/balance)
+	}
+
+	if len(tracer.hits) > 0 {
+		var hits []taintHit
+		for _, hit := range tracer.hits {
+			hits = append(hits, hit)
+		}
+		sort.Slice(hits, func(i, j int) bool {
+			return hits[i].Hop < hits[j].Hop
+		})
+		fmt.Printf("\n%sListed Sources Found:%s\n", Red, Reset)
+		for _, hit := range hits {
+			fmt.Printf("- %s (%s) funding %s, %d hop(s) back\n", labelAddress(hit.Address), hit.Label, hit.TxID, hit.Hop+1)
+		}
+	}
+
+	fmt.Printf("\n- Backend Requests Used: %d of %d\n", tracer.requests, tracer.budget)
+	if tracer.exhausted {
+		fmt.Printf("%s- Budget exhausted, unexplored inputs were counted as clean%s\n", Yellow, Reset)
+	}
+}
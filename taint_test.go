@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// Points input i of tx at output n of prev
+func testSpend(tx *Transaction, i int, prev Transaction, n int) {
+	tx.Inputs[i].PrevOut.TxID = prev.TxID
+	tx.Inputs[i].PrevOut.N = n
+}
+
+// testLegacy is listed. It funds far, which pays testScript, which pays
+// the wallet in "in". The wallet then pays testSegwit from "in" and keeps
+// the change in "out"
+func testTaintHistory() (in, out Transaction, fetcher *testFetcher) {
+	far := testTx("far", 1_700_000_000, []testIO{{testLegacy, 30_000_000}, {testTaproot, 70_000_000}}, []testIO{{testScript, 99_990_000}})
+	in = testTx("in", 1_700_003_600, []testIO{{testScript, 99_990_000}}, []testIO{{testWatched, 99_980_000}})
+	testSpend(&in, 0, far, 0)
+	out = testTx("out", 1_700_007_200, []testIO{{testWatched, 99_980_000}}, []testIO{{testSegwit, 10_000_000}, {testWatched, 89_970_000}})
+	testSpend(&out, 0, in, 0)
+	fetcher = &testFetcher{txs: map[string]Transaction{"far": far, "in": in, "out": out}}
+	return in, out, fetcher
+}
+
+func TestTxTaint(t *testing.T) {
+	riskList := map[string]string{testLegacy: "ransomware"}
+	tests := []struct {
+		name    string
+		tx      func(in, out Transaction) Transaction
+		hops    int
+		haircut float64
+		poison  bool
+		hitHop  int
+	}{
+		{"one hop back", func(in, out Transaction) Transaction { return in }, 1, 0.3, true, 1},
+		{"out of reach", func(in, out Transaction) Transaction { return in }, 0, 0, false, -1},
+		{"own change is not a hop", func(in, out Transaction) Transaction { return out }, 1, 0.3, true, 1},
+	}
+	for _, tt := range tests {
+		in, out, fetcher := testTaintHistory()
+		tracer := newTaintTracer(nil, fetcher, testWatched, riskList, tt.hops, 10)
+		taint := tracer.txTaint(tt.tx(in, out), 0)
+		if math.Abs(taint.haircut-tt.haircut) > 1e-9 || taint.poison != tt.poison {
+			t.Errorf("%s: haircut %v poison %v, want %v %v", tt.name, taint.haircut, taint.poison, tt.haircut, tt.poison)
+		}
+		hit, ok := tracer.hits[testLegacy+"far"]
+		if ok != (tt.hitHop >= 0) || (ok && hit.Hop != tt.hitHop) {
+			t.Errorf("%s: hit %+v (found %v), want hop %d", tt.name, hit, ok, tt.hitHop)
+		}
+	}
+}
+
+// Haircut splits by value, poison marks anything that touched a listed input
+func TestTxTaintModels(t *testing.T) {
+	riskList := map[string]string{testLegacy: "scam"}
+	tx := testTx("mixed", 0, []testIO{{testLegacy, 1_000}, {testScript, 99_000}}, []testIO{{testWatched, 99_000}})
+	tracer := newTaintTracer(nil, &testFetcher{}, testWatched, riskList, 0, 10)
+	taint := tracer.txTaint(tx, 0)
+	if math.Abs(taint.haircut-0.01) > 1e-9 || !taint.poison {
+		t.Errorf("haircut %v poison %v, want 0.01 true", taint.haircut, taint.poison)
+	}
+
+	clean := testTx("clean", 0, []testIO{{testScript, 99_000}}, []testIO{{testWatched, 99_000}})
+	if taint := tracer.txTaint(clean, 0); taint.haircut != 0 || taint.poison {
+		t.Errorf("clean tx: haircut %v poison %v", taint.haircut, taint.poison)
+	}
+}
+
+func TestTaintBudget(t *testing.T) {
+	in, _, fetcher := testTaintHistory()
+	tracer := newTaintTracer(nil, fetcher, testWatched, map[string]string{testLegacy: "scam"}, 3, 0)
+	if taint := tracer.txTaint(in, 0); taint.poison {
+		t.Errorf("taint found without a single request")
+	}
+	if !tracer.exhausted || fetcher.requests != 0 {
+		t.Errorf("exhausted %v after %d requests, want true after 0", tracer.exhausted, fetcher.requests)
+	}
+}
+
+func TestTaintTxCache(t *testing.T) {
+	db := testDB(t)
+	_, _, fetcher := testTaintHistory()
+	tracer := newTaintTracer(db, fetcher, testWatched, nil, 3, 10)
+	if _, err := tracer.fetch("far"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracer.fetch("far"); err != nil || fetcher.requests != 1 {
+		t.Errorf("second fetch: %v after %d requests, want it served from memory", err, fetcher.requests)
+	}
+
+	// A new trace reads confirmed txs back from the database
+	tracer = newTaintTracer(db, fetcher, testWatched, nil, 3, 10)
+	tx, err := tracer.fetch("far")
+	if err != nil || tx.TxID != "far" || fetcher.requests != 1 || tracer.requests != 0 {
+		t.Errorf("cached fetch: %v, %d backend requests, want far from tx_cache", err, fetcher.requests)
+	}
+
+	// Pending txs can still change and aren't kept
+	pending := testTx("pending", 0, []testIO{{testScript, 1_000}}, []testIO{{testWatched, 900}})
+	pending.BlockHeight = 0
+	fetcher.txs["pending"] = pending
+	tracer.fetch("pending")
+	tracer = newTaintTracer(db, fetcher, testWatched, nil, 3, 10)
+	tracer.fetch("pending")
+	if fetcher.requests != 3 {
+		t.Errorf("%d backend requests, want the pending tx fetched twice", fetcher.requests)
+	}
+}
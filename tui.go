@@ -0,0 +1,719 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"crypto_tracker/analysis"
+	"golang.org/x/term"
+)
+
+const (
+	TUI_MIN_LIST_ROWS = 5                      // list rows kept when the detail pane is tall
+	TUI_RESIZE_POLL   = 250 * time.Millisecond // how often the terminal size is checked
+)
+
+var tuiTabs = []string{"Transactions", "Summary", "Analysis", "Risk"}
+
+var tuiSortKeys = []string{"time", "amount", "fee", "confirmations"}
+
+type tuiRow struct {
+	tx      Transaction
+	details TransactionDetails
+}
+
+// Address in the detail pane that can be opened with enter
+type tuiLink struct {
+	addr string
+	line int
+}
+
+// One opened wallet. Jumping to a counterparty pushes a new one
+type walletView struct {
+	address   string
+	wallet    *WalletResponse
+	clusters  *Clusters
+	rows      []tuiRow
+	findings  []analysis.Finding
+	risk      *RiskAssessment
+	screening []ScreeningMatch
+	summary   []string
+
+	tab          int
+	sortKey      int
+	sortAsc      bool
+	cursor       int
+	offset       int
+	detailFocus  bool
+	detailCursor int
+	scroll       int // first line shown on the text tabs
+}
+
+type tui struct {
+	out       *os.File
+	db        *sql.DB
+	analyzers []analysis.Analyzer
+	feeRate   float64
+	views     []*walletView
+	status    string
+	width     int
+	height    int
+}
+
+func (t *tui) view() *walletView {
+	return t.views[len(t.views)-1]
+}
+
+// Reports print as they run, keep them off the screen while loading
+func silenceOutput() func() {
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return func() {}
+	}
+	stdout := os.Stdout
+	os.Stdout = devnull
+	log.SetOutput(io.Discard)
+	return func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+		devnull.Close()
+	}
+}
+
+func currentPrice(db *sql.DB) float64 {
+	if !fiatEnabled() {
+		return 0
+	}
+	now := time.Now().Unix()
+	price, err := GetPrice(now)
+	if err != nil {
+		if price, err = GetPrice2(db, now); err != nil {
+			return 0
+		}
+	}
+	return price.Usd
+}
+
+// Fetches a wallet and runs the analyzers on it, the same work main does
+func (t *tui) load(address string) (*walletView, error) {
+	addrInfo, err := validateAddress(address, network)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := backend.FetchWallet(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallet: %v", err)
+	}
+
+	restore := silenceOutput()
+	defer restore()
+
+	clusters := buildClusters(wallet.Transactions)
+	labels.clusters = clusters
+	details := buildTransactionDetails(t.db, wallet, address)
+	screening, _ := screenTransactions(t.db, wallet.Transactions, address, 0, 0)
+
+	price := currentPrice(t.db)
+	// Browsing is read-only, the mempool tracker keeps its state for real runs
+	state := &runState{db: t.db, clusters: clusters, screening: screening, price: price, feeRate: t.feeRate, readOnly: true}
+	ctx := &analysis.Context{Address: address, Transactions: wallet.Transactions, Details: details, Fetcher: backend, State: state}
+	findings := append(screeningFindings(screening), runAnalyzers(t.analyzers, ctx)...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Severity > findings[j].Severity })
+
+	v := &walletView{
+		address:   address,
+		wallet:    wallet,
+		clusters:  clusters,
+		findings:  findings,
+		risk:      state.risk,
+		screening: screening,
+		summary:   summaryLines(wallet, addrInfo, price),
+	}
+	for _, tx := range wallet.Transactions {
+		if d, ok := details[tx.TxID]; ok {
+			v.rows = append(v.rows, tuiRow{tx: tx, details: d})
+		}
+	}
+	v.sortRows()
+	return v, nil
+}
+
+func summaryLines(wallet *WalletResponse, addrInfo *AddressInfo, price float64) []string {
+	btc := func(sats int64) string { return fmt.Sprintf("%.8f BTC", float64(sats)/100_000_000) }
+	lines := []string{
+		"Address:          " + wallet.Address,
+		"Address Type:     " + string(addrInfo.Type),
+	}
+	if l, _, ok := labels.Lookup(wallet.Address); ok {
+		label := l.Label
+		if l.Category != "" {
+			label += " (" + l.Category + ")"
+		}
+		lines = append(lines, "Label:            "+label)
+	}
+	lines = append(lines,
+		"Total Received:   "+btc(wallet.TotalReceived),
+		"Total Sent:       "+btc(wallet.TotalSent),
+		"Balance:          "+btc(wallet.FinalBalance),
+	)
+	if fiatEnabled() {
+		lines = append(lines, fmt.Sprintf("Current Value:    $%.2f", float64(wallet.FinalBalance)/100_000_000*price))
+	}
+	pending := pendingTotals(wallet.Address, wallet.Transactions)
+	if pending.IncomingCount+pending.OutgoingCount > 0 {
+		lines = append(lines,
+			fmt.Sprintf("Pending Incoming: %s (%d tx)", btc(pending.Incoming), pending.IncomingCount),
+			fmt.Sprintf("Pending Outgoing: %s (%d tx)", btc(pending.Outgoing), pending.OutgoingCount))
+	}
+	lines = append(lines, fmt.Sprintf("Transactions:     %d", wallet.TxCount), "Network:          "+string(network))
+
+	fp := buildFingerprint(wallet.Transactions)
+	if fp.Total > 0 {
+		var first, last time.Time
+		for _, tx := range wallet.Transactions {
+			if tx.Time == 0 {
+				continue
+			}
+			t := time.Unix(int64(tx.Time), 0).UTC()
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+		lines = append(lines, "", "First Seen:       "+first.Format("2006-01-02 15:04 UTC"), "Last Seen:        "+last.Format("2006-01-02 15:04 UTC"))
+		if fp.OffsetKnown {
+			lines = append(lines, "Likely Timezone:  "+formatUTCOffset(fp.Offset))
+		}
+	}
+	privacy := buildPrivacyReport(wallet.Transactions, wallet.Address, labels.clusters)
+	lines = append(lines, fmt.Sprintf("Privacy Score:    %d/100 (%s)", privacy.Score, privacy.Grade()))
+	return lines
+}
+
+func (v *walletView) sortRows() {
+	key := tuiSortKeys[v.sortKey]
+	less := func(a, b tuiRow) bool {
+		switch key {
+		case "amount":
+			return a.details.Amount < b.details.Amount
+		case "fee":
+			return a.tx.Fee < b.tx.Fee
+		case "confirmations":
+			return a.details.Confirmations < b.details.Confirmations
+		}
+		// Pending txs have no time yet, they are the newest
+		if a.tx.Time == 0 || b.tx.Time == 0 {
+			return a.tx.Time != 0 && b.tx.Time == 0
+		}
+		return a.tx.Time < b.tx.Time
+	}
+	sort.SliceStable(v.rows, func(i, j int) bool {
+		if v.sortAsc {
+			return less(v.rows[i], v.rows[j])
+		}
+		return less(v.rows[j], v.rows[i])
+	})
+}
+
+func (v *walletView) selected() *tuiRow {
+	if v.cursor < 0 || v.cursor >= len(v.rows) {
+		return nil
+	}
+	return &v.rows[v.cursor]
+}
+
+func (t *tui) tabBar() string {
+	var b strings.Builder
+	used := 0
+	for i, name := range tuiTabs {
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		used += len(label)
+		if i == t.view().tab {
+			b.WriteString("\x1b[7m" + label + "\x1b[0m")
+		} else {
+			b.WriteString(label)
+		}
+	}
+	depth := ""
+	if len(t.views) > 1 {
+		depth = fmt.Sprintf("  (%d deep, backspace to go back)", len(t.views)-1)
+	}
+	return b.String() + fitWidth("  "+labelAddress(t.view().address)+depth, t.width-used)
+}
+
+func (t *tui) draw() {
+	if w, h, err := term.GetSize(int(t.out.Fd())); err == nil {
+		t.width, t.height = w, h
+	}
+	v := t.view()
+
+	body := t.height - 3 // tab bar, separator and footer
+	var lines []string
+	switch v.tab {
+	case 0:
+		lines = t.transactionLines(body)
+	case 1:
+		lines = scrollLines(v.summary, &v.scroll, body, t.width)
+	case 2:
+		lines = scrollLines(findingLines(v.findings), &v.scroll, body, t.width)
+	case 3:
+		lines = scrollLines(riskLines(v), &v.scroll, body, t.width)
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	b.WriteString(t.tabBar() + "\x1b[K\r\n")
+	b.WriteString(strings.Repeat("─", max(t.width, 0)) + "\r\n")
+	for i := 0; i < body; i++ {
+		if i < len(lines) {
+			b.WriteString(lines[i])
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+
+	help := "↑↓ move  enter details/open  s sort  r reverse  1-4/tab tabs  backspace back  q quit"
+	if t.status != "" {
+		help = t.status
+	}
+	b.WriteString("\x1b[7m" + fitWidth(help, t.width) + "\x1b[0m")
+	t.out.WriteString(b.String())
+}
+
+func scrollLines(all []string, scroll *int, rows, width int) []string {
+	*scroll = max(0, min(*scroll, len(all)-rows))
+	var lines []string
+	for i := *scroll; i < len(all) && len(lines) < rows; i++ {
+		lines = append(lines, " "+fitWidth(all[i], width-1))
+	}
+	return lines
+}
+
+func findingLines(findings []analysis.Finding) []string {
+	if len(findings) == 0 {
+		return []string{"No findings"}
+	}
+	var lines []string
+	for _, f := range findings {
+		lines = append(lines, fmt.Sprintf("[%s] %s (%s)", f.Severity, f.Message, f.ID))
+		if len(f.Addresses) > 0 {
+			lines = append(lines, "    Addresses: "+formatList(f.Addresses, 3))
+		}
+		if len(f.TxIDs) > 0 {
+			lines = append(lines, "    Transactions: "+formatList(f.TxIDs, 3))
+		}
+	}
+	return lines
+}
+
+func riskLines(v *walletView) []string {
+	var lines []string
+	if v.risk == nil {
+		lines = append(lines, "No risk assessment")
+	} else {
+		lines = append(lines, fmt.Sprintf("%s RISK - score %d/100 (%d of %d rules triggered)",
+			v.risk.Level, v.risk.Score, len(v.risk.Hits), v.risk.Evaluated), "")
+		for _, hit := range v.risk.Hits {
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s (%s = %.4g %s %.4g, weight %.4g)",
+				hit.Rule.Severity, hit.Rule.ID, hit.Rule.Description,
+				hit.Rule.Metric, hit.Value, hit.Rule.Operator, hit.Rule.Threshold, hit.Rule.Weight))
+		}
+		for _, skipped := range v.risk.Skipped {
+			lines = append(lines, "Skipped rule "+skipped)
+		}
+	}
+
+	lines = append(lines, "", "Blocklist matches:")
+	if len(v.screening) == 0 {
+		lines = append(lines, "- none")
+	}
+	for _, match := range v.screening {
+		lines = append(lines, "- "+match.String())
+	}
+
+	lines = append(lines, "", "High severity findings:")
+	high := 0
+	for _, f := range v.findings {
+		if f.Severity >= analysis.High {
+			lines = append(lines, fmt.Sprintf("- [%s] %s", f.Severity, f.Message))
+			high++
+		}
+	}
+	if high == 0 {
+		lines = append(lines, "- none")
+	}
+	return lines
+}
+
+// Inputs and outputs of the selected tx, with the addresses that can be opened
+func detailLines(row *tuiRow, address string) ([]string, []tuiLink) {
+	tx, d := row.tx, row.details
+	confirmations := fmt.Sprintf("%d confirmations", d.Confirmations)
+	if d.Pending {
+		confirmations = "pending"
+	}
+	lines := []string{
+		"TxID: " + tx.TxID,
+		fmt.Sprintf("%s  %s  fee %s  %s", d.Time.UTC().Format("2006-01-02 15:04:05 UTC"), confirmations,
+			formatFee(tx), strings.Join(d.Flags, ",")),
+		fmt.Sprintf("Inputs (%d):", len(tx.Inputs)),
+	}
+	var links []tuiLink
+	addrLine := func(addr string, value int64, note string) {
+		text := addr
+		if addr == "" {
+			text = "(no address)"
+		} else if addr != address {
+			text = labelAddress(addr)
+			links = append(links, tuiLink{addr: addr, line: len(lines)})
+		} else {
+			note = strings.TrimSpace(note + " watched")
+		}
+		line := fmt.Sprintf("  %.8f  %s", float64(value)/100_000_000, text)
+		if note != "" {
+			line += "  [" + note + "]"
+		}
+		lines = append(lines, line)
+	}
+	for _, in := range tx.Inputs {
+		addrLine(in.PrevOut.Addr, in.PrevOut.Value, "")
+	}
+	lines = append(lines, fmt.Sprintf("Outputs (%d):", len(tx.Out)))
+	var roles []OutputRole
+	if paidByWallet(tx, address) {
+		roles = detectChange(tx, address)
+	}
+	for i, out := range tx.Out {
+		note := ""
+		if i < len(roles) && roles[i].Change {
+			note = fmt.Sprintf("change %.0f%%", roles[i].Confidence*100)
+		}
+		addrLine(out.Addr, out.Value, note)
+	}
+	return lines, links
+}
+
+func (t *tui) transactionLines(rows int) []string {
+	v := t.view()
+	if len(v.rows) == 0 {
+		return []string{" No transactions"}
+	}
+
+	var detail []string
+	var links []tuiLink
+	if row := v.selected(); row != nil {
+		detail, links = detailLines(row, v.address)
+	}
+	// The detail pane takes what it needs, up to half the screen
+	detailRows := min(len(detail), max(rows/2, rows-TUI_MIN_LIST_ROWS-2))
+	listRows := rows - detailRows - 2 // column header and separator
+
+	if v.cursor < v.offset {
+		v.offset = v.cursor
+	}
+	if v.cursor >= v.offset+listRows {
+		v.offset = v.cursor - listRows + 1
+	}
+
+	order := "desc"
+	if v.sortAsc {
+		order = "asc"
+	}
+	cols := fmt.Sprintf(" %-19s  %14s  %-11s  %9s  %-9s  ", "Time", "Amount (BTC)", "Confirms", "Fee (sat)", "Flags")
+	lines := []string{"\x1b[1m" + fitWidth(cols+"Counterparty   sorted by "+tuiSortKeys[v.sortKey]+" "+order, t.width) + "\x1b[0m"}
+	for i := v.offset; i < len(v.rows) && i < v.offset+listRows; i++ {
+		r := v.rows[i]
+		amount := r.details.Amount
+		counterparty := r.details.DisplayOrigin
+		color := Green
+		if amount < 0 {
+			amount = -r.details.PaymentAmount
+			counterparty = r.details.DisplayDest
+			color = Red
+		}
+		confirms := fmt.Sprintf("%d", r.details.Confirmations)
+		when := r.details.Time.UTC().Format("2006-01-02 15:04:05")
+		if r.details.Pending {
+			confirms, when = "pending", "-"
+		}
+		text := fmt.Sprintf(" %-19s  %14.8f  %-11s  %9d  %-9s  %s", when, amount, confirms, r.tx.Fee,
+			fitWidth(strings.Join(r.details.Flags, ","), 9), counterparty)
+		text = fitWidth(text, t.width)
+		switch {
+		case i == v.cursor && !v.detailFocus:
+			lines = append(lines, "\x1b[7m"+text+"\x1b[0m")
+		case i == v.cursor:
+			lines = append(lines, "\x1b[1m"+text+"\x1b[0m")
+		default:
+			lines = append(lines, color+text+Reset)
+		}
+	}
+	for len(lines) < listRows+1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, strings.Repeat("─", max(t.width, 0)))
+
+	// Keep the selected address visible in the detail pane
+	selectedLine := -1
+	if v.detailFocus && len(links) > 0 {
+		v.detailCursor = max(0, min(v.detailCursor, len(links)-1))
+		selectedLine = links[v.detailCursor].line
+	}
+	start := 0
+	if selectedLine >= detailRows {
+		start = selectedLine - detailRows + 1
+	}
+	for i := start; i < len(detail) && i < start+detailRows; i++ {
+		text := " " + fitWidth(detail[i], t.width-1)
+		if i == selectedLine {
+			text = "\x1b[7m" + text + "\x1b[0m"
+		}
+		lines = append(lines, text)
+	}
+	return lines
+}
+
+// Opens the selected counterparty in a new view
+func (t *tui) open() {
+	v := t.view()
+	row := v.selected()
+	if row == nil {
+		return
+	}
+	_, links := detailLines(row, v.address)
+	if v.detailCursor >= len(links) {
+		return
+	}
+	addr := links[v.detailCursor].addr
+
+	t.status = "Loading " + addr + " ..."
+	t.draw()
+	next, err := t.load(addr)
+	if err != nil {
+		t.status = "Error: " + err.Error()
+		labels.clusters = v.clusters
+		return
+	}
+	t.status = ""
+	t.views = append(t.views, next)
+}
+
+func (t *tui) back() {
+	if len(t.views) == 1 {
+		return
+	}
+	t.views = t.views[:len(t.views)-1]
+	labels.clusters = t.view().clusters
+}
+
+// Handles one key, false quits
+func (t *tui) handle(key string) bool {
+	v := t.view()
+	t.status = ""
+	page := max(1, t.height/2)
+
+	move := func(delta int) {
+		switch {
+		case v.tab != 0:
+			v.scroll += delta
+		case v.detailFocus:
+			v.detailCursor = max(0, v.detailCursor+delta)
+		default:
+			v.cursor = max(0, min(v.cursor+delta, len(v.rows)-1))
+			v.detailCursor = 0
+		}
+	}
+
+	switch key {
+	case "q", "ctrl-c":
+		return false
+	case "up", "k":
+		move(-1)
+	case "down", "j":
+		move(1)
+	case "pgup":
+		move(-page)
+	case "pgdn":
+		move(page)
+	case "home", "g":
+		move(-v.cursor - v.scroll - v.detailCursor)
+	case "end", "G":
+		// Clamped when drawn
+		move(len(v.rows) + len(v.summary) + len(v.findings)*3 + 100)
+	case "tab", "right":
+		v.tab = (v.tab + 1) % len(tuiTabs)
+	case "left":
+		v.tab = (v.tab + len(tuiTabs) - 1) % len(tuiTabs)
+	case "1", "2", "3", "4":
+		v.tab = int(key[0] - '1')
+	case "s":
+		v.sortKey = (v.sortKey + 1) % len(tuiSortKeys)
+		v.sortRows()
+	case "r":
+		v.sortAsc = !v.sortAsc
+		v.sortRows()
+	case "enter":
+		if v.tab != 0 {
+			break
+		}
+		if v.detailFocus {
+			t.open()
+		} else {
+			v.detailFocus, v.detailCursor = true, 0
+		}
+	case "esc":
+		if v.detailFocus {
+			v.detailFocus = false
+		} else {
+			t.back()
+		}
+	case "backspace", "b":
+		t.back()
+	}
+	return true
+}
+
+// Splits raw terminal input into key names
+func parseKeys(buf []byte) []string {
+	escapes := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdn",
+		"\x1b[H": "home", "\x1b[1~": "home", "\x1bOH": "home",
+		"\x1b[F": "end", "\x1b[4~": "end", "\x1bOF": "end",
+	}
+	var keys []string
+	for len(buf) > 0 {
+		if buf[0] == 0x1b {
+			matched := false
+			for seq, name := range escapes {
+				if strings.HasPrefix(string(buf), seq) {
+					keys = append(keys, name)
+					buf = buf[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, "esc")
+				buf = buf[1:]
+			}
+			continue
+		}
+		switch buf[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case '\t':
+			keys = append(keys, "tab")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			keys = append(keys, string(buf[0]))
+		}
+		buf = buf[1:]
+	}
+	return keys
+}
+
+func (t *tui) loop() {
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, key := range parseKeys(buf[:n]) {
+				keys <- key
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(TUI_RESIZE_POLL)
+	defer ticker.Stop()
+	t.draw()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || !t.handle(key) {
+				return
+			}
+			t.draw()
+		case <-ticker.C:
+			if w, h, err := term.GetSize(int(t.out.Fd())); err == nil && (w != t.width || h != t.height) {
+				t.out.WriteString("\x1b[2J")
+				t.draw()
+			}
+		}
+	}
+}
+
+// tui -wallet <address>
+func runTUI(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	address := fs.String("wallet", "", "Bitcoin wallet address to browse")
+	analyzerList := fs.String("analyzers", "default", "Analyzers run for the analysis and risk tabs")
+	feeRate := fs.Float64("feerate", 10, "Feerate in sat/vB used to decide which UTXOs are dust")
+	rulesPath := fs.String("risk-rules", "", "YAML file with risk scoring rules (see: rules)")
+	common := addCommonFlags(fs)
+	fs.Parse(args)
+
+	if *address == "" {
+		log.Fatal("Usage: tui -wallet <address>")
+	}
+	common.apply()
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		log.Fatal("tui needs an interactive terminal")
+	}
+
+	analyzers, err := parseAnalyzers(*analyzerList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rules, err := loadRiskRules(*rulesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	riskRules = rules
+
+	db, err := sql.Open("sqlite3", "btcprice.db")
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+	if store, err := loadLabels(db); err == nil {
+		labels = store
+	}
+
+	t := &tui{out: os.Stdout, db: db, analyzers: analyzers, feeRate: *feeRate}
+	fmt.Printf("Loading %s ...\n", *address)
+	first, err := t.load(*address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t.views = []*walletView{first}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatalf("Error switching the terminal to raw mode: %v", err)
+	}
+	// Alternate screen, hidden cursor
+	t.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	defer func() {
+		t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		term.Restore(int(os.Stdin.Fd()), state)
+	}()
+	t.loop()
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto_tracker/analysis"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("\x1b[Aj\r\t\x7f\x03q\x1b\x1b[5~\x1bOH"))
+	want := "[up j enter tab backspace ctrl-c q esc pgup home]"
+	if fmt.Sprint(keys) != want {
+		t.Errorf("keys %v, want %s", keys, want)
+	}
+}
+
+// Rows named by txid: pending "p", and "a" to "c" with amounts 3, -1, 2
+func testTUIView() *walletView {
+	v := &walletView{address: testWatched}
+	for i, amount := range []float64{3, -1, 2} {
+		txid := string(rune('a' + i))
+		v.rows = append(v.rows, tuiRow{
+			tx:      Transaction{TxID: txid, Time: 1_700_000_000 + i*600, Fee: int64(100 * (3 - i))},
+			details: TransactionDetails{Amount: amount, Confirmations: 3 - i},
+		})
+	}
+	v.rows = append(v.rows, tuiRow{tx: Transaction{TxID: "p", Fee: 50}, details: TransactionDetails{Amount: 1, Pending: true}})
+	return v
+}
+
+func rowIDs(v *walletView) string {
+	var ids []string
+	for _, r := range v.rows {
+		ids = append(ids, r.tx.TxID)
+	}
+	return strings.Join(ids, "")
+}
+
+func TestSortRows(t *testing.T) {
+	tests := []struct {
+		key   int
+		asc   bool
+		order string
+	}{
+		{0, false, "pcba"},
+		{0, true, "abcp"},
+		{1, true, "bpca"},
+		{2, false, "abcp"},
+		{3, true, "pcba"},
+	}
+	for _, tt := range tests {
+		v := testTUIView()
+		v.sortKey, v.sortAsc = tt.key, tt.asc
+		v.sortRows()
+		if got := rowIDs(v); got != tt.order {
+			t.Errorf("by %s asc=%v: %s, want %s", tuiSortKeys[tt.key], tt.asc, got, tt.order)
+		}
+	}
+}
+
+func TestScrollLines(t *testing.T) {
+	all := []string{"one", "two", "three", "four"}
+	tests := []struct {
+		scroll, rows, clamped int
+		first                 string
+	}{
+		{0, 2, 0, " one"},
+		{1, 2, 1, " two"},
+		{10, 2, 2, " three"},
+		{-3, 2, 0, " one"},
+		{2, 10, 0, " one"},
+	}
+	for _, tt := range tests {
+		scroll := tt.scroll
+		lines := scrollLines(all, &scroll, tt.rows, 10)
+		if scroll != tt.clamped || len(lines) == 0 || strings.TrimRight(lines[0], " ") != tt.first {
+			t.Errorf("scroll %d over %d rows: at %d showing %q, want %d and %q", tt.scroll, tt.rows, scroll, lines, tt.clamped, tt.first)
+		}
+		if len(lines) > tt.rows {
+			t.Errorf("scroll %d: %d lines, want at most %d", tt.scroll, len(lines), tt.rows)
+		}
+	}
+}
+
+func TestFindingLines(t *testing.T) {
+	if lines := findingLines(nil); fmt.Sprint(lines) != "[No findings]" {
+		t.Errorf("no findings: %v", lines)
+	}
+	lines := findingLines([]analysis.Finding{
+		{ID: "dust.attack", Severity: analysis.Low, Message: "Dust", TxIDs: []string{"a"}},
+		{ID: "risk.x", Severity: analysis.High, Message: "Risky"},
+	})
+	want := "[[low] Dust (dust.attack)|    Transactions: a|[high] Risky (risk.x)]"
+	if got := "[" + strings.Join(lines, "|") + "]"; got != want {
+		t.Errorf("lines %s, want %s", got, want)
+	}
+}
+
+func TestRiskLines(t *testing.T) {
+	v := &walletView{findings: []analysis.Finding{
+		{ID: "dust.poisoning", Severity: analysis.High, Message: "Address poisoning"},
+		{ID: "dust.attack", Severity: analysis.Low, Message: "Dust"},
+	}}
+	got := strings.Join(riskLines(v), "|")
+	want := "No risk assessment||Blocklist matches:|- none||High severity findings:|- [high] Address poisoning"
+	if got != want {
+		t.Errorf("lines %q, want %q", got, want)
+	}
+
+	v.risk = &RiskAssessment{Score: 40, Level: "MEDIUM", Evaluated: 3, Skipped: []string{"y (y not computed)"}, Hits: []RiskHit{{
+		Rule:  RiskRule{ID: "x", Metric: "dust_attacks", Operator: ">", Threshold: 1, Weight: 2, Severity: "medium", Description: "Dusted"},
+		Value: 3,
+	}}}
+	lines := riskLines(v)
+	if lines[0] != "MEDIUM RISK - score 40/100 (1 of 3 rules triggered)" ||
+		lines[2] != "[medium] x: Dusted (dust_attacks = 3 > 1, weight 2)" || lines[3] != "Skipped rule y (y not computed)" {
+		t.Errorf("lines %q", lines)
+	}
+}
+
+func TestDetailLines(t *testing.T) {
+	tx := testTx("pay", 1_700_000_000, []testIO{{testWatched, 1_000_000}, {"", 5_000}}, []testIO{{testLegacy, 300_000}, {testWatched, 704_000}})
+	row := &tuiRow{tx: tx, details: TransactionDetails{Time: time.Unix(1_700_000_000, 0), Confirmations: 2}}
+	lines, links := detailLines(row, testWatched)
+
+	if len(lines) != 8 || lines[3] != "  0.01000000  "+testWatched+"  [watched]" || lines[4] != "  0.00005000  (no address)" {
+		t.Errorf("lines %q", lines)
+	}
+	if !strings.HasSuffix(lines[7], "[change 99% watched]") {
+		t.Errorf("change line %q, want the change note", lines[7])
+	}
+	// Only the counterparty can be opened
+	if len(links) != 1 || links[0].addr != testLegacy || !strings.Contains(lines[links[0].line], testLegacy) {
+		t.Errorf("links %+v, want %s on its own line", links, testLegacy)
+	}
+}
+
+func TestTUIHandle(t *testing.T) {
+	v := testTUIView()
+	ui := &tui{views: []*walletView{v}, height: 20}
+
+	steps := []struct {
+		key   string
+		check func() bool
+	}{
+		{"down", func() bool { return v.cursor == 1 }},
+		{"G", func() bool { return v.cursor == len(v.rows)-1 }},
+		{"g", func() bool { return v.cursor == 0 }},
+		{"enter", func() bool { return v.detailFocus && v.detailCursor == 0 }},
+		{"j", func() bool { return v.detailCursor == 1 && v.cursor == 0 }},
+		{"esc", func() bool { return !v.detailFocus }},
+		{"backspace", func() bool { return len(ui.views) == 1 }},
+		{"s", func() bool { return v.sortKey == 1 && rowIDs(v) == "acpb" }},
+		{"r", func() bool { return v.sortAsc && rowIDs(v) == "bpca" }},
+		{"4", func() bool { return v.tab == 3 }},
+		{"tab", func() bool { return v.tab == 0 }},
+		{"left", func() bool { return v.tab == 3 }},
+		{"down", func() bool { return v.scroll == 1 && v.cursor == 0 }},
+	}
+	for i, step := range steps {
+		if !ui.handle(step.key) {
+			t.Fatalf("step %d: %q quit", i, step.key)
+		}
+		if !step.check() {
+			t.Errorf("step %d: after %q cursor %d, detail %v/%d, sort %d/%v, tab %d, scroll %d",
+				i, step.key, v.cursor, v.detailFocus, v.detailCursor, v.sortKey, v.sortAsc, v.tab, v.scroll)
+		}
+	}
+	if ui.handle("q") {
+		t.Errorf("q didn't quit")
+	}
+}
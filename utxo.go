@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type UTXO struct {
+	TxID    string
+	Vout    int
+	Value   int64
+	Created time.Time
+	Pending bool
+	Type    AddressType
+	Senders []string // who funded it, empty for the wallet's own change
+}
+
+func (u UTXO) Age(now time.Time) time.Duration {
+	if u.Pending {
+		return 0
+	}
+	return now.Sub(u.Created)
+}
+
+// Approximate vbytes needed to spend one input of each script type.
+// P2SH assumes the common wrapped P2WPKH, P2WSH a single-key script
+var inputVSizes = map[AddressType]float64{
+	P2PKH:  148,
+	P2SH:   91,
+	P2WPKH: 68,
+	P2WSH:  105,
+	P2TR:   57.5,
+}
+
+// Fee to spend the utxo at the given feerate
+func spendCost(u UTXO, feeRate float64) float64 {
+	vsize, ok := inputVSizes[u.Type]
+	if !ok {
+		vsize = inputVSizes[P2PKH]
+	}
+	return vsize * feeRate
+}
+
+func utxoSource(u UTXO) string {
+	if len(u.Senders) == 0 {
+		return "own change"
+	}
+	return formatAddresses(u.Senders, 1)
+}
+
+// Unspent outputs paying the address, taken from the fetched history
+func buildUTXOSet(transactions []Transaction, address string) []UTXO {
+	spent := make(map[string]bool)
+	for _, tx := range transactions {
+		for _, in := range tx.Inputs {
+			spent[in.Outpoint()] = true
+		}
+	}
+
+	var utxos []UTXO
+	for _, tx := range transactions {
+		for _, out := range tx.Out {
+			if out.Addr != address || out.Spent || spent[tx.Outpoint(out.N)] {
+				continue
+			}
+			utxos = append(utxos, UTXO{
+				TxID:    tx.TxID,
+				Vout:    out.N,
+				Value:   out.Value,
+				Created: time.Unix(int64(tx.Time), 0),
+				Pending: tx.Pending(),
+				Type:    addressType(out.Addr),
+				Senders: senderAddresses(tx, address),
+			})
+		}
+	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].Value > utxos[j].Value
+	})
+	return utxos
+}
+
+func analyzeUTXOs(transactions []Transaction, address string, currentPrice float64, feeRate float64) Metrics {
+	now := time.Now()
+	utxos := buildUTXOSet(transactions, address)
+
+	fmt.Printf("\n%s=== UTXO Set ===%s\n\n", Yellow, Reset)
+	if len(utxos) == 0 {
+		fmt.Printf("- No unspent outputs in the fetched history\n")
+	}
+
+	var (
+		total       int64
+		weightedAge float64
+		dust        []UTXO
+	)
+	dusted := make(map[string]bool)
+	for _, event := range detectDust(transactions, address) {
+		dusted[fmt.Sprintf("%s:%d", event.TxID, event.Vout)] = true
+	}
+	for _, u := range utxos {
+		age := u.Age(now)
+		ageText := fmt.Sprintf("%.1f days", age.Hours()/24)
+		if u.Pending {
+			ageText = "unconfirmed"
+		}
+
+		fiat := ""
+		if fiatEnabled() {
+			fiat = fmt.Sprintf(" ($%.2f)", float64(u.Value)/100_000_000*currentPrice)
+		}
+		fmt.Printf("- %s:%d  %.8f BTC%s  %s  %s  from %s\n", u.TxID, u.Vout, float64(u.Value)/100_000_000, fiat, ageText, u.Type, utxoSource(u))
+		if dusted[fmt.Sprintf("%s:%d", u.TxID, u.Vout)] {
+			fmt.Printf("  %sUnsolicited dust, don't spend it together with other UTXOs%s\n", Red, Reset)
+		}
+
+		total += u.Value
+		weightedAge += float64(u.Value) * age.Hours() / 24
+		if float64(u.Value) <= spendCost(u, feeRate) {
+			dust = append(dust, u)
+		}
+	}
+
+	// Coin age metrics
+	fmt.Printf("\n%sCoin Age:%s\n", Cyan, Reset)
+	if total > 0 {
+		fmt.Printf("- Average Age of Holdings: %.1f days (value weighted)\n", weightedAge/float64(total))
+	}
+
+	// Coin-days destroyed needs the creation time of each spent coin,
+	// which is only known when the funding tx is in the fetched history
+	created := make(map[string]time.Time)
+	for _, tx := range transactions {
+		for _, out := range tx.Out {
+			if out.Addr == address {
+				created[tx.Outpoint(out.N)] = time.Unix(int64(tx.Time), 0)
+			}
+		}
+	}
+
+	var spends []string
+	var totalCDD float64
+	for _, tx := range transactions {
+		spendTime := time.Unix(int64(tx.Time), 0)
+		var cdd float64
+		var known, unknown int
+		for _, in := range tx.Inputs {
+			if in.PrevOut.Addr != address {
+				continue
+			}
+			fundedAt, ok := created[in.Outpoint()]
+			if !ok {
+				unknown++
+				continue
+			}
+			known++
+			cdd += float64(in.PrevOut.Value) / 100_000_000 * spendTime.Sub(fundedAt).Hours() / 24
+		}
+		if known == 0 && unknown == 0 {
+			continue
+		}
+
+		line := fmt.Sprintf("%s: %.4f coin-days destroyed", tx.TxID, cdd)
+		if unknown > 0 {
+			line += fmt.Sprintf(" (%d inputs funded outside fetched history)", unknown)
+		}
+		spends = append(spends, line)
+		totalCDD += cdd
+	}
+	if len(spends) > 0 {
+		fmt.Printf("- Total Coin-Days Destroyed: %.4f\n", totalCDD)
+		for _, spend := range spends {
+			fmt.Printf("  - %s\n", spend)
+		}
+	}
+
+	if len(dust) > 0 {
+		fmt.Printf("\n%sDust UTXOs (cost more than their value to spend at %.1f sat/vB):%s\n", Yellow, feeRate, Reset)
+		for _, u := range dust {
+			fmt.Printf("- %s:%d  %d sats from %s, ~%.0f sats to spend\n", u.TxID, u.Vout, u.Value, utxoSource(u), spendCost(u, feeRate))
+		}
+	}
+
+	metrics := Metrics{
+		"utxo_count":          float64(len(utxos)),
+		"dust_utxos":          float64(len(dust)),
+		"avg_coin_age_days":   0,
+		"coin_days_destroyed": totalCDD,
+	}
+	if total > 0 {
+		metrics["avg_coin_age_days"] = weightedAge / float64(total)
+	}
+	return metrics
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// 1 BTC in, spent two days later to testSegwit with change back, then a
+// dust payment from testScript
+func testUTXOHistory() []Transaction {
+	const day = 86_400
+	in := testTx("in", 1_700_000_000, []testIO{{testLegacy, 100_001_000}}, []testIO{{testWatched, 100_000_000}})
+	out := testTx("out", 1_700_000_000+2*day, []testIO{{testWatched, 100_000_000}}, []testIO{{testSegwit, 30_000_000}, {testWatched, 69_999_000}})
+	testSpend(&out, 0, in, 0)
+	dust := testTx("dust", 1_700_000_000+3*day, []testIO{{testScript, 100_000}}, []testIO{{testWatched, 500}, {testScript, 98_500}})
+	return []Transaction{in, out, dust}
+}
+
+func TestBuildUTXOSet(t *testing.T) {
+	txs := testUTXOHistory()
+	var got []string
+	for _, u := range buildUTXOSet(txs, testWatched) {
+		got = append(got, fmt.Sprintf("%s:%d:%d:%s:%v", u.TxID, u.Vout, u.Value, u.Type, u.Senders))
+	}
+	want := fmt.Sprintf("[out:1:69999000:P2WPKH:[] dust:0:500:P2WPKH:[%s]]", testScript)
+	if fmt.Sprint(got) != want {
+		t.Errorf("utxos %v, want %s", got, want)
+	}
+
+	// Spent according to the backend, even without the spending tx
+	txs[1].Out[1].Spent = true
+	if utxos := buildUTXOSet(txs, testWatched); len(utxos) != 1 || utxos[0].TxID != "dust" {
+		t.Errorf("utxos %+v, want only the dust once the change is marked spent", utxos)
+	}
+}
+
+func TestSpendCost(t *testing.T) {
+	tests := []struct {
+		typ  AddressType
+		cost float64
+	}{
+		{P2WPKH, 680},
+		{P2TR, 575},
+		{P2PKH, 1480},
+		{"", 1480}, // unknown scripts are costed as legacy
+	}
+	for _, tt := range tests {
+		if got := spendCost(UTXO{Type: tt.typ}, 10); got != tt.cost {
+			t.Errorf("%q at 10 sat/vB: %v, want %v", tt.typ, got, tt.cost)
+		}
+	}
+}
+
+func TestAnalyzeUTXOs(t *testing.T) {
+	tests := []struct {
+		feeRate float64
+		dust    float64
+	}{
+		{1, 0},
+		{10, 1},
+	}
+	for _, tt := range tests {
+		restore := silenceOutput()
+		metrics := analyzeUTXOs(testUTXOHistory(), testWatched, 0, tt.feeRate)
+		restore()
+		if metrics["utxo_count"] != 2 || metrics["dust_utxos"] != tt.dust {
+			t.Errorf("at %v sat/vB: metrics %v, want 2 utxos and %v dust", tt.feeRate, metrics, tt.dust)
+		}
+		// 1 BTC held for two days
+		if math.Abs(metrics["coin_days_destroyed"]-2) > 1e-9 {
+			t.Errorf("coin-days destroyed %v, want 2", metrics["coin_days_destroyed"])
+		}
+	}
+}